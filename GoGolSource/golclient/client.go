@@ -0,0 +1,616 @@
+// Package golclient is a client for the Game of Life server.
+//
+// The types mirror the server's schemas (see /openapi.json on a server);
+// responses are JSON or XML as selected by Client.Format. Failures the
+// server reports are returned as *Error.
+package golclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// Response formats.
+type Format int
+
+const (
+	JSON Format = iota
+	XML
+)
+
+// Media types.
+const (
+	jsonType = "application/json"
+	xmlType  = "application/xml"
+)
+
+func (f Format) mediaType() string {
+	if f == XML {
+		return xmlType
+	}
+	return jsonType
+}
+
+// A client for one server.
+type Client struct {
+	BaseURL    string       // ex. "http://localhost:8080"
+	HTTPClient *http.Client // http.DefaultClient if nil
+	Format     Format
+	APIKey     string // sent as a bearer token if set
+}
+
+// Make a client for a server.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// An error reported by the server (or an unexpected status).
+type Error struct {
+	Status     int    `json:"status" xml:"Status"`
+	StatusText string `json:"error" xml:"Error"`
+	Message    string `json:"message" xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("%d %s", e.Status, e.StatusText)
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.StatusText, e.Message)
+}
+
+// A cycle of a run.
+type GameCycle struct {
+	Cycle          int    `json:"cycle" xml:"Cycle"`
+	StartedAt      int64  `json:"startedAtNS" xml:"StartedAtEpochNS"`
+	EndedAt        int64  `json:"endedAtNS" xml:"EndedAtEpochNS"`
+	Duration       int64  `json:"durationMS" xml:"DurationMS"`
+	GoroutineCount int    `json:"goroutineCount" xml:"GorountineCount"`
+	MaxCycles      int    `json:"maximumCycles" xml:"MaximumCycles"`
+	Checksum       string `json:"checksum,omitempty" xml:"Checksum,omitempty"`
+	Population     int    `json:"population" xml:"Population"`
+	TileSize       int    `json:"tileSize" xml:"TileSize"`
+	Tiles          int    `json:"tiles" xml:"Tiles"`
+	ActiveTiles    int    `json:"activeTiles" xml:"ActiveTiles"` // recomputed
+}
+
+// How an auto-tuned run picked its goroutines (and tile size).
+type Tuning struct {
+	Goroutines int      `json:"goroutines" xml:"Goroutines"`
+	TileSize   int      `json:"tileSize,omitempty" xml:"TileSize,omitempty"`
+	Source     string   `json:"source" xml:"Source"` // calibrated or cached
+	Cycles     int      `json:"calibrationCycles" xml:"CalibrationCycles"`
+	Trials     []*Trial `json:"trials,omitempty" xml:"Trials>Trial,omitempty"`
+}
+
+// A measured calibration cycle.
+type Trial struct {
+	Goroutines     int     `json:"goroutines" xml:"Goroutines"`
+	TileSize       int     `json:"tileSize,omitempty" xml:"TileSize,omitempty"`
+	CellsPerSecond float64 `json:"cellsPerSecond" xml:"CellsPerSecond"`
+}
+
+// A random soup's parameters.
+type Soup struct {
+	Width    int     `json:"width" xml:"Width"`
+	Height   int     `json:"height" xml:"Height"`
+	Density  float64 `json:"density" xml:"Density"`
+	Seed     int64   `json:"seed" xml:"Seed"`
+	Symmetry string  `json:"symmetry,omitempty" xml:"Symmetry,omitempty"`
+}
+
+// An edit of a run's grid.
+type Edit struct {
+	Op      string `json:"op" xml:"Op"`
+	X       int    `json:"x" xml:"X"`
+	Y       int    `json:"y" xml:"Y"`
+	W       int    `json:"w,omitempty" xml:"W,omitempty"`
+	H       int    `json:"h,omitempty" xml:"H,omitempty"`
+	Value   *int   `json:"value,omitempty" xml:"Value,omitempty"`
+	Pattern string `json:"pattern,omitempty" xml:"Pattern,omitempty"`
+	Source  string `json:"source,omitempty" xml:"Source,omitempty"`
+	Seed    []byte `json:"seed,omitempty" xml:"Seed,omitempty"`
+	RLE     string `json:"rle,omitempty" xml:"RLE,omitempty"`
+	Rotate  int    `json:"rotate,omitempty" xml:"Rotate,omitempty"`
+	Flip    bool   `json:"flip,omitempty" xml:"Flip,omitempty"`
+	Mode    string `json:"mode,omitempty" xml:"Mode,omitempty"`
+}
+
+// Something done to a run after it was created.
+type RunEvent struct {
+	Kind    string  `json:"kind" xml:"Kind"`
+	Cycle   int     `json:"cycle" xml:"Cycle"`
+	At      int64   `json:"atNS" xml:"AtEpochNS"`
+	Edits   []*Edit `json:"edits,omitempty" xml:"Edits>Edit,omitempty"`
+	Changed int     `json:"changed,omitempty" xml:"Changed,omitempty"`
+	Cycles  int     `json:"cycles,omitempty" xml:"Cycles,omitempty"`
+}
+
+// Where a forked run came from.
+type Lineage struct {
+	Parent string  `json:"parent" xml:"Parent"`
+	Cycle  int     `json:"cycle" xml:"Cycle"`
+	Edits  []*Edit `json:"edits,omitempty" xml:"Edits>Edit,omitempty"`
+}
+
+// A run.
+type GameRun struct {
+	Name         string       `json:"name" xml:"Name"`
+	ImageURL     string       `json:"imageURL" xml:"ImageURL"`
+	StartedAt    int64        `json:"startedAtNS" xml:"StartedAtEpochNS"`
+	EndedAt      int64        `json:"endedAtNS" xml:"EndedAtEpochNS"`
+	Duration     int64        `json:"durationMS" xml:"DurationMS"`
+	Width        int          `json:"width" xml:"Width"`
+	Height       int          `json:"height" xml:"Height"`
+	OriginX      int          `json:"originX,omitempty" xml:"OriginX,omitempty"` // unbounded grids
+	OriginY      int          `json:"originY,omitempty" xml:"OriginY,omitempty"`
+	Rule         string       `json:"rule" xml:"Rule"`
+	Kernel       string       `json:"kernel" xml:"Kernel"`
+	Topology     string       `json:"topology" xml:"Topology"`
+	MaxCycles    int          `json:"maximumCycles" xml:"MaximumCycles"`
+	Goroutines   int          `json:"goroutineCount" xml:"GoroutineCount"`
+	Soup         *Soup        `json:"soup,omitempty" xml:"Soup,omitempty"`
+	SeedChecksum string       `json:"seedChecksum,omitempty" xml:"SeedChecksum,omitempty"`
+	Cycles       []*GameCycle `json:"gameCycles" xml:"GameCycles>GameCycle,omitempty"`
+	Events       []*RunEvent  `json:"events,omitempty" xml:"Events>Event,omitempty"`
+	Lineage      *Lineage     `json:"lineage,omitempty" xml:"Lineage,omitempty"`
+	Pinned       bool         `json:"pinned,omitempty" xml:"Pinned,omitempty"`
+	ViewedAt     int64        `json:"viewedAtNS" xml:"ViewedAtEpochNS"`
+	DelayIn10ms  int          `json:"delay10MS" xml:"Delay10MS"`
+	Priority     string       `json:"priority" xml:"Priority"`
+	State        string       `json:"state,omitempty" xml:"State,omitempty"` // queued, running or done
+	QueuePos     int          `json:"queuePosition,omitempty" xml:"QueuePosition,omitempty"`
+	WaitMS       int64        `json:"waitMS" xml:"WaitMS"`
+	Tuning       *Tuning      `json:"tuning,omitempty" xml:"Tuning,omitempty"`
+	PlayIndex    int          `json:"playIndex" xml:"PlayIndex"`
+}
+
+// A request to create a run. The seed is fetched from Source or supplied
+// in Seed (any image or pattern format the server accepts).
+type RunRequest struct {
+	Name       string `json:"name" xml:"Name"`
+	Source     string `json:"source,omitempty" xml:"Source,omitempty"`
+	Seed       []byte `json:"seed,omitempty" xml:"Seed,omitempty"`
+	Rule       string `json:"rule,omitempty" xml:"Rule,omitempty"`
+	Cycles     int    `json:"cycles,omitempty" xml:"Cycles,omitempty"`
+	Goroutines int    `json:"goroutines,omitempty" xml:"Goroutines,omitempty"`
+	AutoTune   bool   `json:"autoTune,omitempty" xml:"AutoTune,omitempty"` // pick goroutines
+	Kernel     string `json:"kernel,omitempty" xml:"Kernel,omitempty"`
+	Topology   string `json:"topology,omitempty" xml:"Topology,omitempty"` // bounded, torus or unbounded
+	Delay      int    `json:"delay,omitempty" xml:"Delay,omitempty"`       // GIF frame delay (10ms units)
+	Pinned     bool   `json:"pinned,omitempty" xml:"Pinned,omitempty"`
+	Priority   string `json:"priority,omitempty" xml:"Priority,omitempty"` // low, normal or high
+}
+
+// Get the request values other than the seed as form fields.
+func (rr *RunRequest) fields() (fields map[string]string) {
+	fields = map[string]string{"name": rr.Name, "url": rr.Source, "rule": rr.Rule,
+		"kernel": rr.Kernel, "topology": rr.Topology, "priority": rr.Priority}
+	for k, v := range map[string]int{"cycles": rr.Cycles, "goroutines": rr.Goroutines,
+		"delay": rr.Delay} {
+		if v > 0 {
+			fields[k] = strconv.Itoa(v)
+		}
+	}
+	if rr.Pinned {
+		fields["pinned"] = "true"
+	}
+	if rr.AutoTune {
+		fields["autoTune"] = "true"
+	}
+	for k, v := range fields {
+		if len(v) == 0 {
+			delete(fields, k)
+		}
+	}
+	return
+}
+
+// A run evicted by the server's retention limits.
+type Eviction struct {
+	Name      string `json:"name" xml:"Name"`
+	Reason    string `json:"reason" xml:"Reason"`
+	At        int64  `json:"atNS" xml:"AtEpochNS"`
+	Cycles    int    `json:"cycles" xml:"Cycles"`
+	GridBytes int64  `json:"gridBytes" xml:"GridBytes"`
+}
+
+// A page of runs.
+type RunList struct {
+	Total  int        `json:"total" xml:"Total"`
+	Offset int        `json:"offset" xml:"Offset"`
+	Limit  int        `json:"limit" xml:"Limit"`
+	Runs   []*GameRun `json:"runs" xml:"Runs>GameRun"`
+}
+
+// Run list filters and paging; zero values are the server defaults.
+type ListOptions struct {
+	Offset, Limit        int
+	Prefix, Source, Rule string
+}
+
+// A run's current grid.
+type Board struct {
+	Name       string `json:"name" xml:"Name"`
+	Cycle      int    `json:"cycle" xml:"Cycle"`
+	Width      int    `json:"width" xml:"Width"`
+	Height     int    `json:"height" xml:"Height"`
+	Population int    `json:"population" xml:"Population"`
+	RLE        string `json:"rle" xml:"RLE"`
+}
+
+// A library pattern.
+type Pattern struct {
+	Name        string `json:"name" xml:"Name"`
+	Title       string `json:"title" xml:"Title"`
+	Category    string `json:"category" xml:"Category"`
+	Description string `json:"description,omitempty" xml:"Description,omitempty"`
+	Width       int    `json:"width" xml:"Width"`
+	Height      int    `json:"height" xml:"Height"`
+	RLE         string `json:"rle,omitempty" xml:"RLE,omitempty"`
+}
+
+// The pattern library.
+type PatternList struct {
+	Patterns []*Pattern `json:"patterns" xml:"Pattern"`
+}
+
+// Quota limits; zero is unlimited.
+type Quota struct {
+	MaxRuns        int   `json:"maxConcurrentRuns,omitempty" xml:"MaxConcurrentRuns,omitempty"`
+	MaxCellCycles  int64 `json:"maxCellCycles,omitempty" xml:"MaxCellCycles,omitempty"`
+	MaxStoredBytes int64 `json:"maxStoredBytes,omitempty" xml:"MaxStoredBytes,omitempty"`
+}
+
+// A user's quota and usage.
+type Account struct {
+	Name        string `json:"name" xml:"Name"`
+	Admin       bool   `json:"admin" xml:"Admin"`
+	Quota       Quota  `json:"quota" xml:"Quota"`
+	Runs        int    `json:"runs" xml:"Runs"`
+	ActiveRuns  int    `json:"activeRuns" xml:"ActiveRuns"`
+	CellCycles  int64  `json:"cellCycles" xml:"CellCycles"`
+	StoredBytes int64  `json:"storedBytes" xml:"StoredBytes"`
+}
+
+// Image options for Show; zero values are the server defaults.
+type ShowOptions struct {
+	Form     string // "gif" (animated) or "png" (one cycle)
+	Index    int    // cycle for png
+	MaxCount int    // maximum GIF frames
+	Mag      int    // magnification
+	// Viewport: "fixed" (default), "bounds" or "object"; X and Y (world
+	// coordinates) are sent with W or H, and Object is "X,Y" of a cell of
+	// the object to follow.
+	View       string
+	X, Y, W, H int
+	Object     string
+}
+
+// Play a run from a seed URL (GET /play), replacing any run with the name.
+func (c *Client) Play(ctx context.Context, name, url string) (gr *GameRun, err error) {
+	return c.PlayWith(ctx, &RunRequest{Name: name, Source: url})
+}
+
+// Play a run from rr.Source with the request's settings (GET /play),
+// replacing any run with the name.
+func (c *Client) PlayWith(ctx context.Context, rr *RunRequest) (gr *GameRun, err error) {
+	query := neturl.Values{"ct": {c.Format.mediaType()}}
+	for k, v := range rr.fields() {
+		query.Set(k, v)
+	}
+	request, err := c.newRequest(ctx, "GET", "/play", query, nil)
+	if err != nil {
+		return
+	}
+	gr = &GameRun{}
+	err = c.do(request, 200, gr)
+	return
+}
+
+// Play a run from seed data (POST /play, a form upload), replacing any run
+// with the name. Other request values (rule, cycles, ...) are optional.
+func (c *Client) PlaySeed(ctx context.Context, rr *RunRequest) (gr *GameRun, err error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := rr.fields()
+	fields["ct"] = c.Format.mediaType()
+	for k, v := range fields {
+		if err = form.WriteField(k, v); err != nil {
+			return
+		}
+	}
+	part, err := form.CreateFormFile("seed", rr.Name)
+	if err == nil {
+		_, err = part.Write(rr.Seed)
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		return
+	}
+	request, err := c.newRequest(ctx, "POST", "/play", nil, &body)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	gr = &GameRun{}
+	err = c.do(request, 200, gr)
+	return
+}
+
+// Get an image of a run (GET /show); returns the image and its media type.
+func (c *Client) Show(ctx context.Context, name string, options ShowOptions) (image []byte,
+	contentType string, err error) {
+	query := neturl.Values{"name": {name}}
+	if len(options.Form) > 0 {
+		query.Set("form", options.Form)
+	}
+	for k, v := range map[string]int{"index": options.Index, "maxCount": options.MaxCount,
+		"mag": options.Mag} {
+		if v > 0 {
+			query.Set(k, strconv.Itoa(v))
+		}
+	}
+	if options.W > 0 || options.H > 0 {
+		for k, v := range map[string]int{"x": options.X, "y": options.Y, "w": options.W,
+			"h": options.H} {
+			query.Set(k, strconv.Itoa(v))
+		}
+	}
+	for k, v := range map[string]string{"view": options.View, "object": options.Object} {
+		if len(v) > 0 {
+			query.Set(k, v)
+		}
+	}
+	request, err := c.newRequest(ctx, "GET", "/show", query, nil)
+	if err != nil {
+		return
+	}
+	response, err := c.send(request, 200)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	contentType = response.Header.Get("Content-Type")
+	image, err = ioutil.ReadAll(response.Body)
+	return
+}
+
+// Get all runs by name (GET /history; always JSON).
+func (c *Client) History(ctx context.Context) (runs map[string]*GameRun, err error) {
+	runs, _, err = c.history(ctx)
+	return
+}
+
+// Get recent evictions, most recent first (GET /history).
+func (c *Client) Evictions(ctx context.Context) (evictions []*Eviction, err error) {
+	_, evictions, err = c.history(ctx)
+	return
+}
+
+func (c *Client) history(ctx context.Context) (runs map[string]*GameRun, evictions []*Eviction, err error) {
+	request, err := c.newRequest(ctx, "GET", "/history", nil, nil)
+	if err != nil {
+		return
+	}
+	var game struct {
+		Runs      map[string]*GameRun `xml:"-"`
+		RunList   []*GameRun          `json:"-" xml:"Runs>GameRun"` // XML has no maps
+		Evictions []*Eviction         `xml:"Evictions>Eviction"`
+	}
+	if err = c.do(request, 200, &game); err != nil {
+		return
+	}
+	runs, evictions = game.Runs, game.Evictions
+	if runs == nil {
+		runs = make(map[string]*GameRun)
+	}
+	for _, r := range game.RunList {
+		runs[r.Name] = r
+	}
+	return
+}
+
+// Delete all of the user's runs (DELETE /history); with all, every user's
+// runs (admins only).
+func (c *Client) DeleteHistory(ctx context.Context, all bool) (err error) {
+	var query neturl.Values
+	if all {
+		query = neturl.Values{"all": {"true"}}
+	}
+	request, err := c.newRequest(ctx, "DELETE", "/history", query, nil)
+	if err == nil {
+		err = c.do(request, 204, nil)
+	}
+	return
+}
+
+// Get the user's quota and usage (GET /account).
+func (c *Client) Account(ctx context.Context) (account *Account, err error) {
+	request, err := c.newRequest(ctx, "GET", "/account", nil, nil)
+	if err != nil {
+		return
+	}
+	account = &Account{}
+	err = c.do(request, 200, account)
+	return
+}
+
+// Create (and play) a run (POST /runs); fails if the name is taken.
+func (c *Client) CreateRun(ctx context.Context, rr *RunRequest) (gr *GameRun, err error) {
+	body, err := json.Marshal(rr)
+	if err != nil {
+		return
+	}
+	request, err := c.newRequest(ctx, "POST", "/runs", nil, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", jsonType)
+	gr = &GameRun{}
+	err = c.do(request, 201, gr)
+	return
+}
+
+// Get a run (GET /runs/{name}).
+func (c *Client) GetRun(ctx context.Context, name string) (gr *GameRun, err error) {
+	request, err := c.newRequest(ctx, "GET", "/runs/"+neturl.PathEscape(name), nil, nil)
+	if err != nil {
+		return
+	}
+	gr = &GameRun{}
+	err = c.do(request, 200, gr)
+	return
+}
+
+// List runs (GET /runs).
+func (c *Client) ListRuns(ctx context.Context, options ListOptions) (list *RunList, err error) {
+	query := neturl.Values{}
+	for k, v := range map[string]int{"offset": options.Offset, "limit": options.Limit} {
+		if v > 0 {
+			query.Set(k, strconv.Itoa(v))
+		}
+	}
+	for k, v := range map[string]string{"prefix": options.Prefix, "source": options.Source,
+		"rule": options.Rule} {
+		if len(v) > 0 {
+			query.Set(k, v)
+		}
+	}
+	request, err := c.newRequest(ctx, "GET", "/runs", query, nil)
+	if err != nil {
+		return
+	}
+	list = &RunList{}
+	err = c.do(request, 200, list)
+	return
+}
+
+// Delete a run (DELETE /runs/{name}).
+func (c *Client) DeleteRun(ctx context.Context, name string) (err error) {
+	request, err := c.newRequest(ctx, "DELETE", "/runs/"+neturl.PathEscape(name), nil, nil)
+	if err == nil {
+		err = c.do(request, 204, nil)
+	}
+	return
+}
+
+// Pin a run so the server never evicts it, or unpin it
+// (PUT or DELETE /runs/{name}/pin).
+func (c *Client) Pin(ctx context.Context, name string, pinned bool) (err error) {
+	method := "PUT"
+	if !pinned {
+		method = "DELETE"
+	}
+	request, err := c.newRequest(ctx, method, "/runs/"+neturl.PathEscape(name)+"/pin", nil, nil)
+	if err == nil {
+		err = c.do(request, 204, nil)
+	}
+	return
+}
+
+// Get a cycle of a run (GET /runs/{name}/cycles/{n}); 0 is the initial grid.
+func (c *Client) Cycle(ctx context.Context, name string, n int) (gc *GameCycle, err error) {
+	request, err := c.newRequest(ctx, "GET",
+		fmt.Sprintf("/runs/%s/cycles/%d", neturl.PathEscape(name), n), nil, nil)
+	if err != nil {
+		return
+	}
+	gc = &GameCycle{}
+	err = c.do(request, 200, gc)
+	return
+}
+
+// Get a run's current grid (GET /runs/{name}/board).
+func (c *Client) Board(ctx context.Context, name string) (board *Board, err error) {
+	request, err := c.newRequest(ctx, "GET", "/runs/"+neturl.PathEscape(name)+"/board", nil, nil)
+	if err != nil {
+		return
+	}
+	board = &Board{}
+	err = c.do(request, 200, board)
+	return
+}
+
+// Get the pattern library (GET /patterns).
+func (c *Client) Patterns(ctx context.Context) (list *PatternList, err error) {
+	request, err := c.newRequest(ctx, "GET", "/patterns", nil, nil)
+	if err != nil {
+		return
+	}
+	list = &PatternList{}
+	err = c.do(request, 200, list)
+	return
+}
+
+// Make a request accepting the client's format.
+func (c *Client) newRequest(ctx context.Context, method, path string, query neturl.Values,
+	body io.Reader) (request *http.Request, err error) {
+	url := c.BaseURL + path
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+	request, err = http.NewRequestWithContext(ctx, method, url, body)
+	if err == nil {
+		request.Header.Set("Accept", c.Format.mediaType())
+		if len(c.APIKey) > 0 {
+			request.Header.Set("Authorization", "Bearer "+c.APIKey)
+		}
+	}
+	return
+}
+
+// Send a request; any status but want is returned as an *Error.
+func (c *Client) send(request *http.Request, want int) (response *http.Response, err error) {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	response, err = hc.Do(request)
+	if err != nil || response.StatusCode == want {
+		return
+	}
+	defer response.Body.Close()
+	e := &Error{}
+	if b, xerr := ioutil.ReadAll(response.Body); xerr == nil {
+		json.Unmarshal(b, e) // error ignored; not all failures are structured
+	}
+	e.Status = response.StatusCode
+	if len(e.StatusText) == 0 {
+		e.StatusText = http.StatusText(response.StatusCode)
+	}
+	return nil, e
+}
+
+// Send a request and decode the response (JSON or XML, by its media type)
+// into v, if not nil.
+func (c *Client) do(request *http.Request, want int, v interface{}) (err error) {
+	response, err := c.send(request, want)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if v == nil {
+		return
+	}
+	if strings.Contains(response.Header.Get("Content-Type"), "xml") {
+		err = xml.NewDecoder(response.Body).Decode(v)
+	} else {
+		err = json.NewDecoder(response.Body).Decode(v)
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot decode %s %s response: %w", request.Method, request.URL.Path, err)
+	}
+	return
+}
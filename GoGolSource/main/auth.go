@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Authentication, per-user runs and quotas.
+// With an auth file (the authFile setting) requests, except to public
+// paths, need an API key: "Authorization: Bearer <key>", "X-API-Key: <key>"
+// or basic auth with the user name and the key as the password. The file
+// holds SHA-256 hashes of the keys (see "gol keygen"). Each user has their
+// own runs, so names do not collide, and a quota on concurrent runs, cells
+// x cycles played and grid bytes held. Admins can clear every user's runs.
+// Without an auth file all requests share CoreGame without limits.
+
+// Paths served without authentication.
+var publicPaths = map[string]bool{
+	"/": true, "/ui/": true, "/openapi.json": true, "/metrics": true,
+	"/patterns": true, "/patterns/": true,
+}
+
+// Key hash prefix in the auth file.
+const keyHashPrefix = "sha256:"
+
+// Quota limits; zero is unlimited.
+type XQuota struct {
+	MaxRuns        int   `json:"maxConcurrentRuns,omitempty" xml:"MaxConcurrentRuns,omitempty"`
+	MaxCellCycles  int64 `json:"maxCellCycles,omitempty" xml:"MaxCellCycles,omitempty"`   // total, all runs
+	MaxStoredBytes int64 `json:"maxStoredBytes,omitempty" xml:"MaxStoredBytes,omitempty"` // grids held by runs
+}
+
+// A user in the auth file.
+type XUserEntry struct {
+	Name    string  `json:"name"`
+	KeyHash string  `json:"keyHash"` // "sha256:" and the hex SHA-256 of the key
+	Admin   bool    `json:"admin,omitempty"`
+	Quota   *XQuota `json:"quota,omitempty"` // default is the file's defaultQuota
+}
+
+// The auth file (JSON).
+type XAuthFile struct {
+	DefaultQuota XQuota        `json:"defaultQuota"`
+	Users        []*XUserEntry `json:"users"`
+}
+
+// A user's account as returned to clients.
+type XAccount struct {
+	Name        string `json:"name" xml:"Name"`
+	Admin       bool   `json:"admin" xml:"Admin"`
+	Quota       XQuota `json:"quota" xml:"Quota"`
+	Runs        int    `json:"runs" xml:"Runs"`
+	ActiveRuns  int    `json:"activeRuns" xml:"ActiveRuns"`
+	CellCycles  int64  `json:"cellCycles" xml:"CellCycles"`
+	StoredBytes int64  `json:"storedBytes" xml:"StoredBytes"`
+}
+
+// An authenticated user.
+type User struct {
+	Name    string
+	Admin   bool
+	Quota   XQuota
+	Game    *Game // the user's runs
+	keyHash []byte
+
+	lock       sync.Mutex // guards usage
+	activeRuns int
+	cellCycles int64 // played
+	reserved   int64 // requested by runs playing
+}
+
+// Error values.
+var (
+	UnauthorizedError = errors.New("unauthorized")
+	QuotaError        = errors.New("quota exceeded")
+)
+
+var authFileFlag string
+
+var (
+	authLock    sync.Mutex
+	authEnabled bool
+	users       map[string]*User // by name
+)
+
+// Load (or reload) the auth file; an empty path disables authentication.
+// Users keep their runs and usage across reloads.
+func loadAuthFile(path string) (err error) {
+	if len(path) == 0 {
+		authLock.Lock()
+		authEnabled, users = false, nil
+		authLock.Unlock()
+		return
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var af XAuthFile
+	if err = json.Unmarshal(b, &af); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	authLock.Lock()
+	defer authLock.Unlock()
+	loaded := make(map[string]*User)
+	for i, ue := range af.Users {
+		var hash []byte
+		switch {
+		case len(ue.Name) == 0 || strings.Contains(ue.Name, "/"):
+			err = fmt.Errorf("user %d: bad name %q", i+1, ue.Name)
+		case loaded[ue.Name] != nil:
+			err = fmt.Errorf("user %s: listed twice", ue.Name)
+		case !strings.HasPrefix(ue.KeyHash, keyHashPrefix):
+			err = fmt.Errorf("user %s: keyHash must start with %q", ue.Name, keyHashPrefix)
+		default:
+			hash, err = hex.DecodeString(ue.KeyHash[len(keyHashPrefix):])
+			if err == nil && len(hash) != sha256.Size {
+				err = fmt.Errorf("wrong length")
+			}
+			if err != nil {
+				err = fmt.Errorf("user %s: bad keyHash: %v", ue.Name, err)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		u := users[ue.Name]
+		if u == nil {
+			u = &User{Name: ue.Name, Game: &Game{Runs: make(map[string]*GameRun)}}
+		}
+		u.lock.Lock()
+		u.Admin, u.Quota, u.keyHash = ue.Admin, af.DefaultQuota, hash
+		if ue.Quota != nil {
+			u.Quota = *ue.Quota
+		}
+		u.lock.Unlock()
+		u.Game.SetDefaults(CoreGame.MaxCycles, CoreGame.GoroutineCount, CoreGame.AutoTune)
+		loaded[ue.Name] = u
+	}
+	authEnabled, users = true, loaded
+	return
+}
+
+// Get every game: CoreGame and each user's.
+func allGames() (games []*Game) {
+	games = []*Game{CoreGame}
+	authLock.Lock()
+	defer authLock.Unlock()
+	for _, u := range users {
+		games = append(games, u.Game)
+	}
+	return
+}
+
+// Find the user for a request; nil (without error) if auth is disabled.
+func authenticate(request *http.Request) (user *User, err error) {
+	authLock.Lock()
+	defer authLock.Unlock()
+	if !authEnabled {
+		return
+	}
+	name, key := "", ""
+	if h := request.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		key = strings.TrimSpace(h[len("Bearer "):])
+	} else if k := request.Header.Get("X-API-Key"); len(k) > 0 {
+		key = k
+	} else if n, password, ok := request.BasicAuth(); ok {
+		name, key = n, password
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%w: an API key is required", UnauthorizedError)
+	}
+	hash := sha256.Sum256([]byte(key))
+	for _, u := range users {
+		if subtle.ConstantTimeCompare(hash[:], u.keyHash) == 1 &&
+			(len(name) == 0 || name == u.Name) {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown API key", UnauthorizedError)
+}
+
+type userKey struct{}
+
+// Require authentication (if enabled) before a handler.
+func authWrapper(path string, f http.HandlerFunc) http.HandlerFunc {
+	if publicPaths[path] {
+		return f
+	}
+	return func(writer http.ResponseWriter, request *http.Request) {
+		user, err := authenticate(request)
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="gol"`)
+			sendError(writer, 401, "%v", err)
+			return
+		}
+		if user != nil {
+			request = request.WithContext(context.WithValue(request.Context(), userKey{}, user))
+		}
+		f(writer, request)
+	}
+}
+
+// Get the user making a request; nil if auth is disabled.
+func requestUser(request *http.Request) (user *User) {
+	user, _ = request.Context().Value(userKey{}).(*User)
+	return
+}
+
+// Get the game (runs) a request works on.
+func requestGame(request *http.Request) *Game {
+	if user := requestUser(request); user != nil {
+		return user.Game
+	}
+	return CoreGame
+}
+
+// Report if a request may act on every user's runs.
+func requestIsAdmin(request *http.Request) bool {
+	user := requestUser(request)
+	return user == nil || user.Admin
+}
+
+// Admit a run (or more cycles of one) of the requested cells x cycles under
+// the user's quota; it is refused if it would go over. The caller must call
+// done with the cells x cycles played. Nil users are unlimited.
+func (u *User) admit(requested int64) (done func(cellCycles int64), status int, err error) {
+	if u == nil {
+		return func(int64) {}, 0, nil
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	q := u.Quota
+	switch {
+	case q.MaxRuns > 0 && u.activeRuns >= q.MaxRuns:
+		return nil, 429, fmt.Errorf("%w: %d concurrent runs", QuotaError, q.MaxRuns)
+	case q.MaxCellCycles > 0 && u.cellCycles+u.reserved+requested > q.MaxCellCycles:
+		left := q.MaxCellCycles - u.cellCycles - u.reserved
+		if left < 0 {
+			left = 0
+		}
+		return nil, 403, fmt.Errorf("%w: %d cells x cycles requested, %d of %d left",
+			QuotaError, requested, left, q.MaxCellCycles)
+	case q.MaxStoredBytes > 0 && u.Game.GridBytes() >= q.MaxStoredBytes:
+		return nil, 403, fmt.Errorf("%w: %d bytes of runs held; delete some runs",
+			QuotaError, q.MaxStoredBytes)
+	}
+	u.activeRuns++
+	u.reserved += requested
+	done = func(cellCycles int64) {
+		u.lock.Lock()
+		defer u.lock.Unlock()
+		u.activeRuns--
+		u.reserved -= requested
+		u.cellCycles += cellCycles
+	}
+	return
+}
+
+// Admit a run once it is made (see RunParams.Admit); done is set if it is
+// admitted, and status if not.
+func (u *User) runAdmitter(endpoint string, done *func(int64), status *int) func(*GameRun) error {
+	return func(gr *GameRun) (err error) {
+		*done, *status, err = u.admit(gr.plannedCellCycles())
+		if err == nil {
+			runsStarted.Inc(endpoint)
+		}
+		return
+	}
+}
+
+// Get the cells x cycles a new run will play (at its starting size).
+func (gr *GameRun) plannedCellCycles() int64 {
+	return int64(gr.Width) * int64(gr.Height) * int64(gr.MaxCycles)
+}
+
+// Get the cells x cycles a run has played.
+func (gr *GameRun) cellCycles() int64 {
+	width, height, cycles := gr.size()
+	return int64(width) * int64(height) * int64(cycles)
+}
+
+// Make the client form of the requesting user's account.
+func makeReturnedAccount(request *http.Request) (xa *XAccount) {
+	user := requestUser(request)
+	game := requestGame(request)
+	xa = &XAccount{Name: "anonymous", Admin: true}
+	if user != nil {
+		user.lock.Lock()
+		xa = &XAccount{Name: user.Name, Admin: user.Admin, Quota: user.Quota,
+			ActiveRuns: user.activeRuns, CellCycles: user.cellCycles}
+		user.lock.Unlock()
+	}
+	xa.Runs, xa.StoredBytes = len(game.RunNames()), game.GridBytes()
+	return
+}
+
+// Account request handler.
+//
+//	GET /account  get the requesting user's quota and usage
+func accountHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.Header().Set("Allow", "GET")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	ct, ok := negotiate(request, jsonType, xmlType)
+	if !ok {
+		sendError(writer, 406, "supported types: %s, %s", jsonType, xmlType)
+		return
+	}
+	sendValue(writer, 200, ct, makeReturnedAccount(request))
+}
+
+// Make a new API key and its auth file entry.
+func NewAPIKey(name string, admin bool) (key string, ue *XUserEntry, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	key = "gol_" + base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(key))
+	ue = &XUserEntry{Name: name, KeyHash: keyHashPrefix + hex.EncodeToString(hash[:]), Admin: admin}
+	return
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Send a request as a user.
+func userRequest(u *User, handler http.HandlerFunc, method, target string,
+	body interface{}) (recorder *httptest.ResponseRecorder) {
+	ba, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, target, strings.NewReader(string(ba)))
+	request.Header.Set("Content-Type", jsonType)
+	request = request.WithContext(context.WithValue(request.Context(), userKey{}, u))
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	return
+}
+
+func TestQuotaCountsRequestedCellCycles(t *testing.T) {
+	u := &User{Name: "u", Quota: XQuota{MaxCellCycles: 1500},
+		Game: &Game{Runs: make(map[string]*GameRun), Quiet: true}}
+	u.Game.SetDefaults(10, 1, false)
+	seed := []byte("x = 10, y = 10\n3o!") // 100 cells
+	for _, step := range []struct {
+		what, target string
+		body         interface{}
+		status       int
+		played       int64
+	}{
+		{"create over", "/runs", &XRunRequest{Name: "a", Seed: seed, Cycles: 16}, 403, 0},
+		{"create", "/runs", &XRunRequest{Name: "a", Seed: seed}, 201, 1000},
+		{"fork over", "/runs/a/fork", &XForkRequest{Name: "f", Cycles: 6}, 403, 1000},
+		{"continue over", "/runs/a/continue?cycles=6", nil, 403, 1000},
+		{"fork", "/runs/a/fork", &XForkRequest{Name: "f", Cycles: 3}, 201, 1300},
+		{"continue over", "/runs/a/continue?cycles=3", nil, 403, 1300},
+		{"continue", "/runs/a/continue?cycles=2", nil, 200, 1500},
+		{"create over", "/runs", &XRunRequest{Name: "b", Seed: seed, Cycles: 1}, 403, 1500},
+	} {
+		handler := runHandler
+		if step.target == "/runs" {
+			handler = runsHandler
+		}
+		recorder := userRequest(u, handler, "POST", step.target, step.body)
+		if recorder.Code != step.status {
+			t.Fatalf("%s %s: got %d (%s), want %d", step.what, step.target, recorder.Code,
+				recorder.Body.String(), step.status)
+		}
+		if u.cellCycles != step.played || u.reserved != 0 || u.activeRuns != 0 {
+			t.Fatalf("%s %s: played %d, reserved %d, active %d; want %d played", step.what,
+				step.target, u.cellCycles, u.reserved, u.activeRuns, step.played)
+		}
+	}
+	if _, ok := u.Game.GetRun("b"); ok { // refused "a" and "f" would conflict
+		t.Errorf("refused run was recorded")
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Benchmark settings.
+type BenchConfig struct {
+	Warmup     int      // untimed runs per configuration
+	Reps       int      // timed runs per configuration
+	Cycles     int      // cycles per run
+	Goroutines []int    // goroutine counts to sweep (and 1, the speedup baseline)
+	Sizes      [][2]int // board sizes to sweep; empty uses the seed size
+	Kernels    []string // kernels to sweep
+	Seed       *Grid    // initial board; tiled to each size (random if nil)
+	Report     bool     // output each timed run
+	Out        io.Writer
+}
+
+// Statistics for one configuration.
+// Durations are per run in milliseconds.
+type XBenchResult struct {
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Kernel     string    `json:"kernel"`
+	Goroutines int       `json:"goroutines"`
+	CPUs       int       `json:"cpus"`
+	Cycles     int       `json:"cycles"`
+	Reps       int       `json:"reps"`
+	Min        float64   `json:"minMS"`
+	Median     float64   `json:"medianMS"`
+	P95        float64   `json:"p95MS"`
+	Mean       float64   `json:"meanMS"`
+	Stddev     float64   `json:"stddevMS"`
+	Speedup    float64   `json:"speedup"`    // vs. 1 goroutine median
+	Efficiency float64   `json:"efficiency"` // speedup / goroutines
+	Samples    []float64 `json:"samplesMS,omitempty"`
+}
+
+// Run all configurations; results are in size, kernel, goroutine order.
+// One goroutine is always timed, as the speedup baseline.
+func RunBenchmarks(bc *BenchConfig) (results []*XBenchResult, err error) {
+	goroutines, err := benchGoroutineCounts(bc.Goroutines)
+	if err != nil {
+		return
+	}
+	sizes := bc.Sizes
+	if len(sizes) == 0 {
+		if bc.Seed == nil {
+			return nil, fmt.Errorf("a board size or seed is required")
+		}
+		sizes = [][2]int{{bc.Seed.Width, bc.Seed.Height}}
+	}
+	for _, size := range sizes {
+		board := benchBoard(bc.Seed, size[0], size[1])
+		for _, kernel := range bc.Kernels {
+			var base *XBenchResult
+			for _, gc := range goroutines {
+				fmt.Fprintf(bc.Out, "Running %dx%d, kernel %s, %d goroutines, %d CPUs...\n",
+					size[0], size[1], kernel, gc, runtime.NumCPU())
+				var br *XBenchResult
+				br, err = benchOne(bc, board, kernel, gc)
+				if err != nil {
+					return
+				}
+				if gc == 1 {
+					base = br
+				}
+				if br.Median > 0 {
+					br.Speedup = base.Median / br.Median
+					br.Efficiency = br.Speedup / float64(gc)
+				}
+				results = append(results, br)
+			}
+		}
+	}
+	return
+}
+
+// Get the goroutine counts to time: 1 and the listed counts, ascending
+// without repeats.
+func benchGoroutineCounts(listed []int) (counts []int, err error) {
+	sorted := append([]int{1}, listed...)
+	sort.Ints(sorted)
+	if sorted[0] < 1 {
+		return nil, fmt.Errorf("goroutine counts must be positive")
+	}
+	for i, n := range sorted {
+		if i == 0 || n != sorted[i-1] {
+			counts = append(counts, n)
+		}
+	}
+	return
+}
+
+// Time one configuration.
+// Each run uses its own Game so runs never replace each other.
+func benchOne(bc *BenchConfig, board *Grid, kernel string, goroutines int) (br *XBenchResult, err error) {
+	br = &XBenchResult{Width: board.Width, Height: board.Height, Kernel: kernel,
+		Goroutines: goroutines, CPUs: runtime.NumCPU(), Cycles: bc.Cycles, Reps: bc.Reps}
+	params := RunParams{Cycles: bc.Cycles, Goroutines: goroutines, Kernel: kernel}
+	for i := 0; i < bc.Warmup+bc.Reps; i++ {
+		g := &Game{Runs: make(map[string]*GameRun), MaxCycles: bc.Cycles, Quiet: true}
+		runtime.GC() // do not charge earlier garbage to this run
+		var gr *GameRun
+		gr, err = g.RunGrid("bench", "bench", board.DeepCloneGrid(), params)
+		if err != nil {
+			return
+		}
+		if i < bc.Warmup {
+			continue
+		}
+		ms := float64(gr.EndedAt.Sub(gr.StartedAt)) / float64(time.Millisecond)
+		br.Samples = append(br.Samples, ms)
+		if bc.Report {
+			fmt.Fprintf(bc.Out, "  rep %d: %.3fms\n", i-bc.Warmup+1, ms)
+		}
+	}
+	br.Min, br.Median, br.P95, br.Mean, br.Stddev = summarize(br.Samples)
+	return
+}
+
+// Compute min, median, 95th percentile, mean and (sample) standard deviation.
+func summarize(samples []float64) (min, median, p95, mean, stddev float64) {
+	n := len(samples)
+	if n == 0 {
+		return
+	}
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	min = sorted[0]
+	median = percentile(sorted, 50)
+	p95 = percentile(sorted, 95)
+	for _, v := range sorted {
+		mean += v
+	}
+	mean /= float64(n)
+	if n > 1 {
+		for _, v := range sorted {
+			stddev += (v - mean) * (v - mean)
+		}
+		stddev = math.Sqrt(stddev / float64(n-1))
+	}
+	return
+}
+
+// Get a percentile (linear interpolation) of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// Make a board by tiling the seed; a fixed random board if no seed.
+func benchBoard(seed *Grid, w, h int) (board *Grid) {
+	board = NewEmptyGrid(w, h)
+	if seed == nil {
+		r := rand.New(rand.NewSource(1)) // same board every time
+		for i := range board.Data {
+			if r.Intn(2) == 0 {
+				board.Data[i] = 1
+			}
+		}
+		return
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			board.setCell(x, y, seed.getCell(x%seed.Width, y%seed.Height))
+		}
+	}
+	return
+}
+
+// Output results as a table.
+func PrintBenchTable(out io.Writer, results []*XBenchResult) {
+	fmt.Fprintf(out, "%-11s %-7s %4s %10s %10s %10s %10s %8s %7s\n",
+		"size", "kernel", "gos", "min ms", "median ms", "p95 ms", "stddev ms", "speedup", "effic")
+	for _, r := range results {
+		fmt.Fprintf(out, "%-11s %-7s %4d %10.3f %10.3f %10.3f %10.3f %8.2f %6.0f%%\n",
+			fmt.Sprintf("%dx%d", r.Width, r.Height), r.Kernel, r.Goroutines,
+			r.Min, r.Median, r.P95, r.Stddev, r.Speedup, r.Efficiency*100)
+	}
+}
+
+// Output results as CSV (one row per configuration).
+func WriteBenchCSV(out io.Writer, results []*XBenchResult) (err error) {
+	w := csv.NewWriter(out)
+	w.Write([]string{"width", "height", "kernel", "goroutines", "cpus", "cycles", "reps",
+		"minMS", "medianMS", "p95MS", "meanMS", "stddevMS", "speedup", "efficiency"})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	for _, r := range results {
+		w.Write([]string{strconv.Itoa(r.Width), strconv.Itoa(r.Height), r.Kernel,
+			strconv.Itoa(r.Goroutines), strconv.Itoa(r.CPUs), strconv.Itoa(r.Cycles),
+			strconv.Itoa(r.Reps), f(r.Min), f(r.Median), f(r.P95), f(r.Mean),
+			f(r.Stddev), f(r.Speedup), f(r.Efficiency)})
+	}
+	w.Flush()
+	err = w.Error()
+	return
+}
+
+// Output results as JSON.
+func WriteBenchJSON(out io.Writer, results []*XBenchResult) (err error) {
+	ba, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return
+	}
+	_, err = out.Write(ba)
+	return
+}
+
+const markers = "*.^~-=+"
+
+// Print (to out) a chart of speedup vs. goroutine count; one series
+// (marker) per board size and kernel. Adapted from PrintPlot.
+func PrintBenchChart(out io.Writer, results []*XBenchResult, ysteps int) {
+	type series struct {
+		label  string
+		points map[int]float64
+	}
+	var all []*series
+	var xs []int
+	seen := map[int]bool{}
+	ymax := 1.0
+	for _, r := range results {
+		label := fmt.Sprintf("%dx%d %s", r.Width, r.Height, r.Kernel)
+		if len(all) == 0 || all[len(all)-1].label != label {
+			all = append(all, &series{label, map[int]float64{}})
+		}
+		all[len(all)-1].points[r.Goroutines] = r.Speedup
+		if !seen[r.Goroutines] {
+			seen[r.Goroutines] = true
+			xs = append(xs, r.Goroutines)
+		}
+		ymax = math.Max(ymax, r.Speedup)
+	}
+	sort.Ints(xs)
+	if len(xs) == 0 || ysteps <= 0 {
+		return
+	}
+	ystep := ymax / float64(ysteps)
+	const colWidth = 4
+	fmt.Fprintln(out, "Speedup vs. goroutines:")
+	for yIndex := 0; yIndex < ysteps; yIndex++ {
+		ytop, ybottom := ymax-float64(yIndex)*ystep, ymax-float64(yIndex+1)*ystep
+		fmt.Fprintf(out, "%8.2f: ", ytop)
+		for _, x := range xs {
+			pv := " "
+			for i, s := range all {
+				if v, ok := s.points[x]; ok && v <= ytop && v > ybottom {
+					pv = string(markers[i%len(markers)])
+				}
+			}
+			fmt.Fprint(out, strings.Repeat(" ", colWidth-1)+pv)
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "%8s  ", "")
+	for _, x := range xs {
+		fmt.Fprintf(out, "%*d", colWidth, x)
+	}
+	fmt.Fprintln(out)
+	for i, s := range all {
+		fmt.Fprintf(out, "  %c %s\n", markers[i%len(markers)], s.label)
+	}
+}
+
+var sizeRE = regexp.MustCompile(`^(\d+)x(\d+)$`)
+
+// Parse a comma separated list of WxH sizes.
+func ParseSizes(list string) (sizes [][2]int, err error) {
+	for _, item := range splitList(list) {
+		parts := sizeRE.FindStringSubmatch(item)
+		if parts == nil {
+			return nil, fmt.Errorf("bad size %q; want WxH", item)
+		}
+		w, _ := strconv.Atoi(parts[1])
+		h, _ := strconv.Atoi(parts[2])
+		if err = checkSeedSize(w, h); err != nil {
+			return
+		}
+		sizes = append(sizes, [2]int{w, h})
+	}
+	return
+}
+
+// Parse a comma separated list of positive integers.
+func ParseInts(list string) (values []int, err error) {
+	for _, item := range splitList(list) {
+		var v int
+		v, err = strconv.Atoi(item)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("bad count %q", item)
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// Write results to a file using a writer function.
+func writeBenchFile(path string, f func(io.Writer, []*XBenchResult) error,
+	results []*XBenchResult) (err error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	err = f(out, results)
+	if xerr := out.Close(); err == nil {
+		err = xerr
+	}
+	return
+}
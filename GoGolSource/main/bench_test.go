@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBenchmarksTimeOneGoroutine(t *testing.T) {
+	for _, listed := range [][]int{{4, 2}, {2, 4, 1, 2}, nil} {
+		bc := &BenchConfig{Reps: 1, Cycles: 2, Goroutines: listed, Sizes: [][2]int{{32, 32}},
+			Kernels: []string{DefaultKernelName}, Out: ioutil.Discard}
+		results, err := RunBenchmarks(bc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, br := range results {
+			got = append(got, br.Goroutines)
+			if br.Speedup <= 0 || br.Efficiency <= 0 {
+				t.Errorf("%v: %d goroutines has no speedup", listed, br.Goroutines)
+			}
+		}
+		want := []int{1, 2, 4}
+		if listed == nil {
+			want = []int{1}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) || results[0].Speedup != 1 {
+			t.Errorf("%v: timed %v, want %v with 1 the baseline", listed, got, want)
+		}
+	}
+	if _, err := RunBenchmarks(&BenchConfig{Goroutines: []int{0}, Out: ioutil.Discard}); err == nil {
+		t.Errorf("0 goroutines was accepted")
+	}
+}
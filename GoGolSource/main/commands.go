@@ -0,0 +1,893 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image/gif"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Subcommands: gol <command> [flags] [arguments].
+
+// Exit codes.
+const (
+	exitOK     = 0
+	exitUsage  = 1 // bad command, flags or arguments
+	exitFailed = 2 // the command failed
+	exitServer = 3 // the server failed
+	exitDiffer = 4 // the grids differ (diff, verify)
+)
+
+// A subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "run a pattern headlessly and write GIF/PNG/RLE/stats", runCommand},
+		{"render", "re-render a run saved by \"run -stats\"", renderCommand},
+		{"edit", "edit, continue or rewind a run saved by \"run -stats\"", editCommand},
+		{"fork", "fork a run saved by \"run -stats\" into a new run", forkCommand},
+		{"diff", "compare two runs cycle by cycle", diffCommand},
+		{"verify", "replay runs saved by \"run -stats\" and check their checksums", verifyCommand},
+		{"serve", "start the HTTP server", serveCommand},
+		{"keygen", "make an API key and its auth file entry", keygenCommand},
+		{"bench", "benchmark goroutine counts, board sizes and kernels", benchCommand},
+		{"convert", "translate between image and pattern formats", convertCommand},
+		{"search", "run random soups and take a census of the objects left", searchCommand},
+		{"help", "show help for a command", helpCommand},
+	}
+}
+
+const commandsDescription = `
+Play the game of Life.
+Usage: gol <command> [flags] [arguments]
+Use "gol help <command>" for command flags.
+Commands:
+`
+
+// Run a named command; returns the exit code.
+func RunCommand(name string, args []string) int {
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	printCommands(os.Stderr)
+	return exitUsage
+}
+
+func printCommands(out io.Writer) {
+	fmt.Fprintln(out, strings.TrimSpace(commandsDescription))
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, `Flags alone (no command) select the original flag based interface.`)
+}
+
+// Setting flags shared by local commands; serve shares all settings.
+// Any setting can still come from a config file or the environment.
+var localFlags = []string{"config", "print-config", "maxCycles", "goroutines",
+	"magFactor", "fileRoot", "allowSchemes", "allowHosts", "allowPrivate",
+	"denyNets", "maxDownload", "loadTimeout"}
+
+// Make a flag set for a command. Shared flags are bound to the same
+// variables as the top level flags.
+func newFlagSet(name, usage string, shared ...string) (fs *flag.FlagSet) {
+	fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: gol %s %s\nFlags:\n", name, strings.TrimSpace(usage))
+		fs.PrintDefaults()
+	}
+	if name == "serve" {
+		shared = append(shared, "config", "print-config")
+		shared = append(shared, configKeys...)
+	} else {
+		shared = append(shared, localFlags...)
+	}
+	for _, sn := range shared {
+		if fs.Lookup(sn) != nil {
+			continue
+		}
+		f := flag.Lookup(sn)
+		fs.Var(f.Value, f.Name, f.Usage)
+		fs.Lookup(sn).DefValue = f.DefValue
+	}
+	return
+}
+
+// Parse command flags and load the configuration.
+// Returns false (with an exit code) if the command should not continue.
+func parseCommand(fs *flag.FlagSet, args []string, minArgs, maxArgs int) (code int, ok bool) {
+	err := fs.Parse(args)
+	switch {
+	case err == flag.ErrHelp:
+		return exitOK, false
+	case err != nil:
+		return exitUsage, false
+	case fs.NArg() < minArgs || fs.NArg() > maxArgs:
+		fmt.Fprintf(os.Stderr, "gol %s: wrong number of arguments\n", fs.Name())
+		fs.Usage()
+		return exitUsage, false
+	}
+	if err = LoadConfig(fs); err != nil {
+		fmt.Fprintf(os.Stderr, "bad configuration: %v\n", err)
+		return exitUsage, false
+	}
+	if printConfigFlag {
+		if err = PrintConfig(); err != nil {
+			return exitFailed, false
+		}
+		return exitOK, false
+	}
+	return exitOK, true
+}
+
+// Local (not server) commands trust local files unless configured.
+func trustLocalFiles() {
+	flag.Lookup("fileRoot").DefValue = string(filepath.Separator)
+}
+
+// Make a URL from a command argument; plain paths are local files
+// (relative to the working directory, not the file root).
+func argumentURL(arg string) string {
+	if strings.Contains(arg, ":") {
+		return arg
+	}
+	if abs, err := filepath.Abs(arg); err == nil {
+		arg = abs
+	}
+	return FilePrefix + arg
+}
+
+// Write output to a file or, for "-", standard output.
+func writeOutput(path string, f func(w io.Writer) error) (err error) {
+	if path == "-" {
+		return f(os.Stdout)
+	}
+	var b bytes.Buffer
+	if err = f(&b); err != nil {
+		return
+	}
+	err = ioutil.WriteFile(path, b.Bytes(), 0644)
+	return
+}
+
+// Report a command failure.
+func commandFailed(name string, err error) int {
+	fmt.Fprintf(os.Stderr, "gol %s: %v\n", name, err)
+	return exitFailed
+}
+
+// A run saved with its seed so it can be re-rendered or verified.
+type XSavedRun struct {
+	Run  *XGameRun `json:"run"`
+	Seed string    `json:"seedRLE"`
+}
+
+// Output options shared by run and render.
+type runOutputs struct {
+	gifPath, pngPath, rlePath, statsPath string
+	index, maxCount                      int
+}
+
+func (ro *runOutputs) addFlags(fs *flag.FlagSet, stats bool) {
+	fs.StringVar(&ro.gifPath, "gif", "", "write an animated GIF of the cycles to this file (- for stdout)")
+	fs.StringVar(&ro.pngPath, "png", "", "write a PNG of one cycle to this file (- for stdout)")
+	fs.IntVar(&ro.index, "index", -1, "cycle written by -png; 0 is the initial grid; default is the last")
+	fs.IntVar(&ro.maxCount, "maxCount", 100, "maximum GIF frames")
+	if stats {
+		fs.StringVar(&ro.rlePath, "rle", "", "write the final grid as RLE to this file (- for stdout)")
+		fs.StringVar(&ro.statsPath, "stats", "", "write run statistics and seed as JSON to this file (- for stdout)")
+	}
+}
+
+func (ro *runOutputs) count() (n int) {
+	for _, p := range []string{ro.gifPath, ro.pngPath, ro.rlePath, ro.statsPath} {
+		if len(p) > 0 {
+			n++
+		}
+	}
+	return
+}
+
+// Write the requested outputs of a run.
+func (ro *runOutputs) write(gr *GameRun) (err error) {
+	if len(ro.gifPath) > 0 {
+		err = writeOutput(ro.gifPath, func(w io.Writer) (err error) {
+			agif, err := gr.MakeGIFs(ro.maxCount)
+			if err == nil {
+				err = gif.EncodeAll(w, agif)
+			}
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+	if len(ro.pngPath) > 0 {
+		index := ro.index
+		if index < 0 {
+			index = len(gr.Cycles)
+		}
+		err = writeOutput(ro.pngPath, func(w io.Writer) error {
+			return gr.MakePNG(w, index)
+		})
+		if err != nil {
+			return
+		}
+	}
+	if len(ro.rlePath) > 0 {
+		err = writeOutput(ro.rlePath, func(w io.Writer) (err error) {
+			_, err = io.WriteString(w, FormatRLE(gr.CurrentGrid, gr.Rule))
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+	if len(ro.statsPath) > 0 {
+		err = writeOutput(ro.statsPath, func(w io.Writer) (err error) {
+			saved := &XSavedRun{makeReturnedRun(gr), FormatRLE(gr.InitialGrid, gr.Rule)}
+			ba, err := json.MarshalIndent(saved, "", "  ")
+			if err == nil {
+				_, err = w.Write(append(ba, '\n'))
+			}
+			return
+		})
+	}
+	return
+}
+
+const runUsage = `[flags] [url]
+Run a pattern (image or pattern file, or URL) without a server.
+Writes run statistics as JSON to stdout if no output is requested.`
+
+// Run command.
+func runCommand(args []string) int {
+	var url, name, rule, kernel string
+	var ro runOutputs
+	trustLocalFiles()
+	fs := newFlagSet("run", runUsage)
+	fs.StringVar(&url, "url", "", urlHelp)
+	fs.StringVar(&name, "name", "run", nameHelp)
+	fs.StringVar(&rule, "rule", DefaultRuleName, "rule in B/S notation")
+	fs.StringVar(&kernel, "kernel", DefaultKernelName, "kernel; one of "+strings.Join(KernelNames(), ", "))
+	ro.addFlags(fs, true)
+	if code, ok := parseCommand(fs, args, 0, 1); !ok {
+		return code
+	}
+	if fs.NArg() == 1 {
+		url = fs.Arg(0)
+	}
+	if len(url) == 0 {
+		fmt.Fprintln(os.Stderr, "gol run: a url is required")
+		return exitUsage
+	}
+	if ro.count() == 0 {
+		ro.statsPath = "-"
+	}
+	CoreGame.Quiet = true
+	gr, err := CoreGame.RunWith(name, argumentURL(url), RunParams{Rule: rule, Kernel: kernel})
+	if err != nil {
+		return commandFailed("run", err)
+	}
+	if err = ro.write(gr); err != nil {
+		return commandFailed("run", err)
+	}
+	return exitOK
+}
+
+// Read a run saved by "run -stats".
+func readSavedRun(path string) (saved *XSavedRun, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	saved = &XSavedRun{}
+	if err = json.Unmarshal(b, saved); err != nil {
+		return
+	}
+	if saved.Run == nil || len(saved.Seed) == 0 {
+		err = errors.New("not a saved run")
+	}
+	return
+}
+
+// Replay a saved run with its recorded parameters and events.
+func replaySavedRun(saved *XSavedRun) (gr *GameRun, err error) {
+	grid, err := ParseRLE(saved.Seed)
+	if err != nil {
+		return
+	}
+	xr := saved.Run
+	g := &Game{Runs: make(map[string]*GameRun), MaxCycles: xr.MaxCycles,
+		GoroutineCount: xr.Goroutines, Quiet: true}
+	gr, err = g.RunGrid(xr.Name, xr.ImageURL, grid, RunParams{
+		Rule: xr.Rule, Kernel: xr.Kernel, Topology: xr.Topology, Delay: xr.DelayIn10ms})
+	if err != nil {
+		return
+	}
+	gr.Lineage = xr.Lineage
+	err = gr.ReplayEvents(xr.Events)
+	return
+}
+
+const renderUsage = `[flags] saved.json
+Re-render a run saved by "gol run -stats" (the run is replayed).`
+
+// Render command.
+func renderCommand(args []string) int {
+	var ro runOutputs
+	fs := newFlagSet("render", renderUsage)
+	ro.addFlags(fs, false)
+	if code, ok := parseCommand(fs, args, 1, 1); !ok {
+		return code
+	}
+	if ro.count() == 0 {
+		fmt.Fprintln(os.Stderr, "gol render: -gif or -png is required")
+		return exitUsage
+	}
+	saved, err := readSavedRun(fs.Arg(0))
+	if err != nil {
+		return commandFailed("render", err)
+	}
+	gr, err := replaySavedRun(saved)
+	if err != nil {
+		return commandFailed("render", err)
+	}
+	if err = ro.write(gr); err != nil {
+		return commandFailed("render", err)
+	}
+	return exitOK
+}
+
+const editUsage = `[flags] saved.json
+Replay a run saved by "gol run -stats", apply edits and continue or rewind it.
+Edit, -continue and -rewind flags can repeat and are applied in order. Writes the edited run
+(with its events) as JSON to stdout if no output is requested.`
+
+// Edits, continues and rewinds from the command line, in order.
+type editSteps []func(gr *GameRun) error
+
+// A flag that adds an edit.
+type editFlag struct {
+	op  string
+	add func(e *XEdit)
+}
+
+func (ef *editFlag) String() string { return "" }
+
+func (ef *editFlag) Set(text string) (err error) {
+	e, err := ParseEdit(ef.op, text)
+	if err == nil {
+		ef.add(e)
+	}
+	return
+}
+
+// A flag that adds a continue or rewind step.
+type cycleFlag struct {
+	op    string
+	steps *editSteps
+}
+
+func (cf *cycleFlag) String() string { return "" }
+
+func (cf *cycleFlag) Set(text string) (err error) {
+	var n int
+	if _, err = fmt.Sscanf(text, "%d", &n); err != nil {
+		return fmt.Errorf("bad cycle count %q", text)
+	}
+	*cf.steps = append(*cf.steps, func(gr *GameRun) error {
+		if cf.op == rewindEvent {
+			return gr.Rewind(n)
+		}
+		return gr.Continue(context.Background(), n)
+	})
+	return
+}
+
+// Add the edit flags to a flag set.
+func addEditFlags(fs *flag.FlagSet, add func(e *XEdit)) {
+	fs.Var(&editFlag{setOp, add}, setOp, "set a cell alive: x,y or to a value: x,y,value")
+	fs.Var(&editFlag{toggleOp, add}, toggleOp, "toggle a cell: x,y")
+	fs.Var(&editFlag{clearOp, add}, clearOp, "kill the cells in a rectangle: x,y,w,h")
+	fs.Var(&editFlag{stampOp, add}, stampOp,
+		"stamp a library pattern or url: pattern@x,y[,rotate][,flip] (rotate 90, 180 or 270)")
+}
+
+// Edit command.
+func editCommand(args []string) int {
+	var steps editSteps
+	var ro runOutputs
+	trustLocalFiles()
+	fs := newFlagSet("edit", editUsage)
+	addEditFlags(fs, func(e *XEdit) {
+		steps = append(steps, func(gr *GameRun) error {
+			return gr.Edit([]*XEdit{e})
+		})
+	})
+	fs.Var(&cycleFlag{continueEvent, &steps}, continueEvent, "play this many more cycles")
+	fs.Var(&cycleFlag{rewindEvent, &steps}, rewindEvent, "rewind to this cycle, discarding later ones")
+	ro.addFlags(fs, true)
+	if code, ok := parseCommand(fs, args, 1, 1); !ok {
+		return code
+	}
+	if ro.count() == 0 {
+		ro.statsPath = "-"
+	}
+	saved, err := readSavedRun(fs.Arg(0))
+	if err != nil {
+		return commandFailed("edit", err)
+	}
+	gr, err := replaySavedRun(saved)
+	if err != nil {
+		return commandFailed("edit", err)
+	}
+	for _, step := range steps {
+		if err = step(gr); err != nil {
+			return commandFailed("edit", err)
+		}
+	}
+	if err = ro.write(gr); err != nil {
+		return commandFailed("edit", err)
+	}
+	return exitOK
+}
+
+const forkUsage = `[flags] saved.json
+Replay a run saved by "gol run -stats" and fork it at a cycle into a new run,
+optionally with another rule or with edits to the grid at the fork. Writes
+the new run as JSON to stdout if no output is requested.`
+
+// Fork command.
+func forkCommand(args []string) int {
+	var name, rule string
+	var cycle, cycles int
+	var edits []*XEdit
+	var ro runOutputs
+	trustLocalFiles()
+	fs := newFlagSet("fork", forkUsage)
+	fs.StringVar(&name, "name", "fork", nameHelp)
+	fs.IntVar(&cycle, "cycle", -1, "cycle to fork at; default is the last")
+	fs.IntVar(&cycles, "cycles", 0, "cycles to play; default is as many as the parent played after -cycle")
+	fs.StringVar(&rule, "rule", "", "rule in B/S notation; default is the parent's")
+	addEditFlags(fs, func(e *XEdit) {
+		edits = append(edits, e)
+	})
+	ro.addFlags(fs, true)
+	if code, ok := parseCommand(fs, args, 1, 1); !ok {
+		return code
+	}
+	if ro.count() == 0 {
+		ro.statsPath = "-"
+	}
+	saved, err := readSavedRun(fs.Arg(0))
+	if err != nil {
+		return commandFailed("fork", err)
+	}
+	parent, err := replaySavedRun(saved)
+	if err != nil {
+		return commandFailed("fork", err)
+	}
+	if cycle < 0 {
+		cycle = len(parent.Cycles)
+	}
+	gr, err := parent.Parent.Fork(parent, cycle, name, RunParams{Cycles: cycles, Rule: rule}, edits)
+	if err != nil {
+		return commandFailed("fork", err)
+	}
+	if err = ro.write(gr); err != nil {
+		return commandFailed("fork", err)
+	}
+	return exitOK
+}
+
+const diffUsage = `[flags] a [b]
+Compare run a from cycle -i with run b from cycle -j. Each run is a run
+saved by "run -stats" (a .json file) or a url played with the -rule,
+-kernel and -goroutines flags (-ruleB, -kernelB and -goroutinesB for b).
+b defaults to a. Exits with 4 if the grids differ.`
+
+// Diff command.
+func diffCommand(args []string) int {
+	var rules, kernels [2]string
+	var goroutines [2]int
+	var i, j, steps int
+	var jsonPath, pngPath, gifPath string
+	trustLocalFiles()
+	fs := newFlagSet("diff", diffUsage)
+	fs.IntVar(&i, "i", 0, "cycle of a to start at")
+	fs.IntVar(&j, "j", 0, "cycle of b to start at")
+	fs.IntVar(&steps, "steps", -1, "cycles to compare after the first; default is all")
+	fs.StringVar(&rules[0], "rule", DefaultRuleName, "rule in B/S notation for a url")
+	fs.StringVar(&rules[1], "ruleB", "", "rule for b; default is -rule")
+	fs.StringVar(&kernels[0], "kernel", DefaultKernelName, "kernel for a url; one of "+strings.Join(KernelNames(), ", "))
+	fs.StringVar(&kernels[1], "kernelB", "", "kernel for b; default is -kernel")
+	fs.IntVar(&goroutines[1], "goroutinesB", 0, "goroutines for b; default is -goroutines")
+	fs.StringVar(&jsonPath, "json", "", "write the comparison as JSON to this file (- for stdout)")
+	fs.StringVar(&pngPath, "png", "", "write a diff PNG of the first pair to this file")
+	fs.StringVar(&gifPath, "gif", "", "write a diff GIF of up to 100 pairs to this file")
+	if code, ok := parseCommand(fs, args, 1, 2); !ok {
+		return code
+	}
+	goroutines[0] = goroutinesFlag
+	if len(rules[1]) == 0 {
+		rules[1] = rules[0]
+	}
+	if len(kernels[1]) == 0 {
+		kernels[1] = kernels[0]
+	}
+	if goroutines[1] == 0 {
+		goroutines[1] = goroutines[0]
+	}
+	sources := []string{fs.Arg(0), fs.Arg(0)}
+	if fs.NArg() == 2 {
+		sources[1] = fs.Arg(1)
+	}
+	var runs [2]*GameRun
+	for k, source := range sources {
+		var err error
+		if strings.HasSuffix(source, ".json") {
+			var saved *XSavedRun
+			if saved, err = readSavedRun(source); err == nil {
+				runs[k], err = replaySavedRun(saved)
+			}
+		} else {
+			g := &Game{Runs: make(map[string]*GameRun), MaxCycles: maxCyclesFlag,
+				GoroutineCount: goroutines[k], Quiet: true}
+			runs[k], err = g.RunWith([]string{"a", "b"}[k], argumentURL(source),
+				RunParams{Rule: rules[k], Kernel: kernels[k], Goroutines: goroutines[k]})
+		}
+		if err != nil {
+			return commandFailed("diff", fmt.Errorf("%s: %w", source, err))
+		}
+	}
+	xd, err := DiffRuns(runs[0], i, runs[1], j, steps)
+	if err != nil {
+		return commandFailed("diff", err)
+	}
+	if len(jsonPath) > 0 {
+		err = writeOutput(jsonPath, func(w io.Writer) (err error) {
+			ba, err := json.MarshalIndent(xd, "", "  ")
+			if err == nil {
+				_, err = w.Write(append(ba, '\n'))
+			}
+			return
+		})
+	}
+	if err == nil && len(pngPath) > 0 {
+		err = writeOutput(pngPath, func(w io.Writer) error {
+			return MakeDiffPNG(w, runs[0], i, runs[1], j)
+		})
+	}
+	if err == nil && len(gifPath) > 0 {
+		err = writeOutput(gifPath, func(w io.Writer) (err error) {
+			agif, err := MakeDiffGIF(runs[0], i, runs[1], j, maxDiffFrames)
+			if err == nil {
+				err = gif.EncodeAll(w, agif)
+			}
+			return
+		})
+	}
+	if err != nil {
+		return commandFailed("diff", err)
+	}
+	if jsonPath != "-" {
+		PrintDiff(os.Stdout, xd)
+	}
+	if !xd.Identical {
+		return exitDiffer
+	}
+	return exitOK
+}
+
+const verifyUsage = `[flags] saved.json...
+Replay runs saved by "gol run -stats" and check the checksum of every cycle,
+reporting the first divergent cycle. Each run is replayed with each of
+-kernels and -goroutineCounts (by default, the recorded ones). Exits with 4
+if any run diverges.`
+
+// Verify command.
+func verifyCommand(args []string) int {
+	var kernelList, countList string
+	fs := newFlagSet("verify", verifyUsage)
+	fs.StringVar(&kernelList, "kernels", "", "comma separated kernels, or all; default is the recorded kernel")
+	fs.StringVar(&countList, "goroutineCounts", "", "comma separated goroutine counts; default is the recorded count")
+	if code, ok := parseCommand(fs, args, 1, math.MaxInt32); !ok {
+		return code
+	}
+	kernels := splitList(kernelList)
+	if kernelList == "all" {
+		kernels = KernelNames()
+	}
+	for _, k := range kernels {
+		if _, ok := Kernels[k]; !ok {
+			fmt.Fprintf(os.Stderr, "gol verify: unknown kernel %q; known: %v\n", k, KernelNames())
+			return exitUsage
+		}
+	}
+	if len(kernels) == 0 {
+		kernels = []string{""}
+	}
+	counts, err := ParseInts(countList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gol verify: bad goroutineCounts: %v\n", err)
+		return exitUsage
+	}
+	if len(counts) == 0 {
+		counts = []int{0}
+	}
+	code := exitOK
+	for _, path := range fs.Args() {
+		saved, err := readSavedRun(path)
+		if err != nil {
+			return commandFailed("verify", fmt.Errorf("%s: %w", path, err))
+		}
+		for _, kernel := range kernels {
+			for _, n := range counts {
+				vr, err := VerifySavedRun(saved, kernel, n)
+				if err != nil {
+					return commandFailed("verify", fmt.Errorf("%s: %w", path, err))
+				}
+				if vr.OK() {
+					fmt.Printf("ok    %s %s/%d: %d cycles\n", path, vr.Kernel, vr.Goroutines, vr.Cycles)
+					continue
+				}
+				fmt.Printf("FAIL  %s %s/%d: cycle %d checksum %s, want %s\n", path, vr.Kernel,
+					vr.Goroutines, vr.Divergence, vr.Actual, vr.Expected)
+				code = exitDiffer
+			}
+		}
+	}
+	return code
+}
+
+const serveUsage = `[flags]
+Start the HTTP server; stops on SIGINT or SIGTERM, reloads settings on SIGHUP.`
+
+// Serve command.
+func serveCommand(args []string) int {
+	fs := newFlagSet("serve", serveUsage)
+	if code, ok := parseCommand(fs, args, 0, 0); !ok {
+		return code
+	}
+	if err := startServer(); err != nil {
+		fmt.Fprintf(os.Stderr, "gol serve: %v\n", err)
+		return exitServer
+	}
+	return exitOK
+}
+
+const keygenUsage = `[flags] user
+Make an API key for a user. Prints the key (give it to the user; it is not
+stored) and the user's entry for the auth file (see -authFile).`
+
+// Keygen command.
+func keygenCommand(args []string) int {
+	var admin bool
+	fs := newFlagSet("keygen", keygenUsage)
+	fs.BoolVar(&admin, "admin", false, "the user can clear every user's runs")
+	if code, ok := parseCommand(fs, args, 1, 1); !ok {
+		return code
+	}
+	if name := fs.Arg(0); strings.Contains(name, "/") {
+		fmt.Fprintf(os.Stderr, "gol keygen: user name cannot contain '/'\n")
+		return exitUsage
+	}
+	key, ue, err := NewAPIKey(fs.Arg(0), admin)
+	if err != nil {
+		return commandFailed("keygen", err)
+	}
+	ba, _ := json.MarshalIndent(ue, "", "  ") // cannot fail
+	fmt.Printf("key: %s\nauth file entry:\n%s\n", key, ba)
+	return exitOK
+}
+
+const benchUsage = `[flags] [url]
+Benchmark cycle timings. The board is the url image (tiled to -benchSizes)
+or, if no url, a fixed random board of each -benchSizes size.`
+
+// Bench command.
+func benchCommand(args []string) int {
+	trustLocalFiles()
+	fs := newFlagSet("bench", benchUsage, "url", "report", "benchWarmup", "benchReps",
+		"benchSizes", "benchGoroutines", "benchKernels", "benchCSV", "benchJSON", "benchChart")
+	if code, ok := parseCommand(fs, args, 0, 1); !ok {
+		return code
+	}
+	if fs.NArg() == 1 {
+		urlFlag = argumentURL(fs.Arg(0))
+	}
+	runBenchmarks() // exits on failure
+	return exitOK
+}
+
+// Pattern formats by file extension.
+var convertFormats = map[string]func(w io.Writer, grid *Grid) error{
+	".png": func(w io.Writer, grid *Grid) error {
+		return renderGrid(grid).MakePNG(w, 0)
+	},
+	".gif": func(w io.Writer, grid *Grid) (err error) {
+		agif, err := renderGrid(grid).MakeGIFs(1)
+		if err == nil {
+			err = gif.EncodeAll(w, agif)
+		}
+		return
+	},
+	".rle": func(w io.Writer, grid *Grid) (err error) {
+		_, err = io.WriteString(w, FormatRLE(grid, ConwayRule))
+		return
+	},
+	".cells": func(w io.Writer, grid *Grid) (err error) {
+		_, err = io.WriteString(w, FormatPlaintext(grid, "converted"))
+		return
+	},
+	".lif": func(w io.Writer, grid *Grid) (err error) {
+		_, err = io.WriteString(w, FormatLife106(grid))
+		return
+	},
+}
+
+// Make a run (with no cycles) to render a grid as an image.
+func renderGrid(grid *Grid) *GameRun {
+	return NewGameRunFromGrid("convert", "convert", grid,
+		&Game{Runs: make(map[string]*GameRun), Quiet: true})
+}
+
+const convertUsage = `[flags] input output
+Translate between image (PNG, GIF, JPEG) and pattern (RLE, plaintext, Life 1.06)
+formats. The input format is sniffed; the output format comes from the output
+file extension (or -format when the output is - for stdout).`
+
+// Convert command.
+func convertCommand(args []string) int {
+	var format string
+	trustLocalFiles()
+	fs := newFlagSet("convert", convertUsage)
+	formats := make([]string, 0, len(convertFormats))
+	for ext := range convertFormats {
+		formats = append(formats, ext[1:])
+	}
+	sort.Strings(formats)
+	fs.StringVar(&format, "format", "", "output format; one of "+strings.Join(formats, ", "))
+	if code, ok := parseCommand(fs, args, 2, 2); !ok {
+		return code
+	}
+	in, out := fs.Arg(0), fs.Arg(1)
+	if len(format) == 0 {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(out)), ".")
+	}
+	write, ok := convertFormats["."+format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gol convert: unknown output format %q; known: %v\n", format, formats)
+		return exitUsage
+	}
+	grid, _, err := LoadSeed(argumentURL(in))
+	if err != nil {
+		return commandFailed("convert", err)
+	}
+	err = writeOutput(out, func(w io.Writer) error {
+		return write(w, grid)
+	})
+	if err != nil {
+		return commandFailed("convert", err)
+	}
+	return exitOK
+}
+
+const searchUsage = `[flags]
+Run random soups (seeds -seed, -seed+1, ...) until each stabilizes, classify
+the objects left (and any that escape) and report a census. Soups with rare or
+unknown objects are listed with the random: URL that replays them.`
+
+// Search command.
+func searchCommand(args []string) int {
+	var soups, workers, margin, generations int
+	var size, symmetry, rule, jsonFile, htmlFile, saveDir string
+	var density float64
+	var seed int64
+	fs := newFlagSet("search", searchUsage)
+	fs.IntVar(&soups, "soups", 1000, "soups to run")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "soups run at once")
+	fs.StringVar(&size, "soupSize", "16x16", "soup size (WxH)")
+	fs.Float64Var(&density, "density", 0.5, "fraction of soup cells alive")
+	fs.StringVar(&symmetry, "symmetry", "", "soup symmetry: C2, C4 or D8")
+	fs.Int64Var(&seed, "seed", 1, "first soup seed")
+	fs.IntVar(&margin, "margin", 96, "dead cells around each soup")
+	fs.IntVar(&generations, "generations", 20_000, "maximum generations per soup")
+	fs.StringVar(&rule, "rule", DefaultRuleName, "rule (B/S notation)")
+	fs.StringVar(&jsonFile, "json", "", "write the census as JSON to this file (- for stdout)")
+	fs.StringVar(&htmlFile, "html", "", "write the census as HTML to this file (- for stdout)")
+	fs.StringVar(&saveDir, "save", "", "save rare soups as RLE in this directory")
+	if code, ok := parseCommand(fs, args, 0, 0); !ok {
+		return code
+	}
+	sc := &SearchConfig{Soups: soups, Workers: workers, Density: density, FirstSeed: seed,
+		Margin: margin, Generations: generations, SaveDir: saveDir, Out: os.Stdout}
+	sizes, err := ParseSizes(size)
+	if err == nil && len(sizes) != 1 {
+		err = fmt.Errorf("want one soup size")
+	}
+	if err == nil {
+		sc.Width, sc.Height = sizes[0][0], sizes[0][1]
+		// check the soup parameters by making one
+		var soup *Soup
+		soup, err = ParseSoup(fmt.Sprintf("%s?w=%d&h=%d&density=%v&symmetry=%s",
+			RandomPrefix, sc.Width, sc.Height, density, symmetry))
+		if soup != nil {
+			sc.Symmetry = soup.Symmetry
+		}
+	}
+	if err == nil {
+		sc.Rule, err = ParseRule(rule)
+	}
+	if err == nil && (soups < 1 || workers < 1 || margin < escapeBand || generations < 1) {
+		err = fmt.Errorf("soups, workers and generations must be positive and margin at least %d",
+			escapeBand)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gol search: %v\n", err)
+		return exitUsage
+	}
+	census, err := RunSearch(sc)
+	if err != nil {
+		return commandFailed("search", err)
+	}
+	if jsonFile != "-" && htmlFile != "-" {
+		PrintCensus(os.Stdout, census)
+	}
+	for _, out := range []struct {
+		path  string
+		write func(io.Writer, *XCensus) error
+	}{{jsonFile, WriteCensusJSON}, {htmlFile, WriteCensusHTML}} {
+		if len(out.path) == 0 {
+			continue
+		}
+		err = writeOutput(out.path, func(w io.Writer) error {
+			return out.write(w, census)
+		})
+		if err != nil {
+			return commandFailed("search", err)
+		}
+	}
+	return exitOK
+}
+
+// Help command.
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		printCommands(os.Stdout)
+		return exitOK
+	}
+	if args[0] == "help" {
+		fmt.Println("Usage: gol help [command]")
+		return exitOK
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run([]string{"-h"})
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	return exitUsage
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Layered configuration.
+// Each setting is the long form of a command line flag. Values come from
+// (lowest to highest precedence): the flag default, a config file
+// (JSON, YAML or TOML by extension), GOL_* environment variables
+// (ex. GOL_MAX_CYCLES) and flags set on the command line.
+
+// Flags that are configuration settings.
+var configKeys = []string{
+	"maxCycles", "goroutines", "autoTune", "magFactor", "saveImage", "saveDir",
+	"addr", "readTimeout", "writeTimeout", "idleTimeout", "shutdownTimeout",
+	"cert", "key",
+	"fileRoot", "allowSchemes", "allowHosts", "allowPrivate", "denyNets",
+	"maxDownload", "loadTimeout", "authFile",
+	"maxRuns", "maxRunBytes", "maxRunAge",
+	"cycleLimit", "goroutineLimit", "delayLimit", "workerLimit", "queueLimit",
+}
+
+// Settings only used when the server starts; reloads log changes to them.
+var restartKeys = map[string]bool{
+	"addr": true, "readTimeout": true, "writeTimeout": true, "idleTimeout": true,
+	"cert": true, "key": true,
+}
+
+// Configuration sources.
+const (
+	defaultSource = "default"
+	fileSource    = "file"
+	envSource     = "env"
+	flagSource    = "flag"
+)
+
+// Environment variable prefix.
+const envPrefix = "GOL_"
+
+// The effective configuration.
+type Config struct {
+	Values  map[string]string `json:"values"`
+	Sources map[string]string `json:"sources"`
+}
+
+var (
+	configLock    sync.Mutex
+	configFile    string          // from -config or GOL_CONFIG
+	setOnCommand  map[string]bool // flags set on the command line
+	currentConfig *Config
+)
+
+// Normalize a key so "maxCycles", "max_cycles" and "MAX-CYCLES" match.
+func normalizeKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "_", "")
+	return strings.ReplaceAll(key, "-", "")
+}
+
+// Map normalized keys to setting names.
+func configKeyIndex() (index map[string]string) {
+	index = make(map[string]string)
+	for _, k := range configKeys {
+		index[normalizeKey(k)] = k
+	}
+	return
+}
+
+// Resolve and apply the configuration after the flags (of the top level
+// or a command's flag set) are parsed.
+func LoadConfig(fs *flag.FlagSet) (err error) {
+	setOnCommand = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		for _, k := range configKeys {
+			if flag.Lookup(k).Value == f.Value { // also matches short forms
+				setOnCommand[k] = true
+			}
+		}
+	})
+	if len(configFile) == 0 {
+		configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+	return ReloadConfig()
+}
+
+// Re-resolve and apply the configuration (ex. on SIGHUP).
+// If the new configuration is not valid the current one is kept.
+func ReloadConfig() (err error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	config, err := resolveConfig()
+	if err != nil {
+		return
+	}
+	previous := currentConfig
+	if err = setFlags(config); err == nil {
+		err = validateConfig()
+	}
+	if err == nil {
+		err = applyConfig()
+	}
+	if err != nil {
+		if previous != nil {
+			setFlags(previous) // error ignored; was valid
+			applyConfig()      // error ignored; was valid
+		}
+		return
+	}
+	if previous != nil {
+		for _, k := range configKeys {
+			if restartKeys[k] && previous.Values[k] != config.Values[k] {
+				fmt.Printf("Config %s changed to %q; takes effect on restart\n",
+					k, config.Values[k])
+			}
+		}
+	}
+	currentConfig = config
+	return
+}
+
+// Get a copy of the effective configuration.
+func EffectiveConfig() (config *Config) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	config = &Config{Values: map[string]string{}, Sources: map[string]string{}}
+	if currentConfig != nil {
+		for k, v := range currentConfig.Values {
+			config.Values[k] = v
+			config.Sources[k] = currentConfig.Sources[k]
+		}
+	}
+	return
+}
+
+// Combine the layers.
+func resolveConfig() (config *Config, err error) {
+	config = &Config{Values: map[string]string{}, Sources: map[string]string{}}
+	index := configKeyIndex()
+	for _, k := range configKeys {
+		f := flag.Lookup(k)
+		config.Values[k], config.Sources[k] = f.DefValue, defaultSource
+	}
+	if len(configFile) > 0 {
+		var values map[string]string
+		values, err = readConfigFile(configFile)
+		if err != nil {
+			return
+		}
+		for k, v := range values {
+			name, ok := index[normalizeKey(k)]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown setting %q", configFile, k)
+			}
+			config.Values[name], config.Sources[name] = v, fileSource
+		}
+	}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if !strings.HasPrefix(parts[0], envPrefix) || parts[0] == envPrefix+"CONFIG" {
+			continue
+		}
+		if name, ok := index[normalizeKey(parts[0][len(envPrefix):])]; ok {
+			config.Values[name], config.Sources[name] = parts[1], envSource
+		}
+	}
+	for k := range setOnCommand {
+		if _, ok := config.Values[k]; ok {
+			config.Values[k], config.Sources[k] = flag.Lookup(k).Value.String(), flagSource
+		}
+	}
+	return
+}
+
+// Set the flag values from a configuration.
+func setFlags(config *Config) (err error) {
+	for _, k := range configKeys {
+		if err = flag.Set(k, config.Values[k]); err != nil {
+			return fmt.Errorf("bad %s (from %s): %v", k, config.Sources[k], err)
+		}
+	}
+	return
+}
+
+// Check the flag values.
+func validateConfig() (err error) {
+	switch {
+	case cycleLimitFlag < 1 || cycleLimitFlag > MaxCyclesLimit:
+		return fmt.Errorf("cycleLimit must be 1 to %d", MaxCyclesLimit)
+	case gorLimitFlag < 1 || gorLimitFlag > MaxGoroutinesLimit:
+		return fmt.Errorf("goroutineLimit must be 1 to %d", MaxGoroutinesLimit)
+	case delayLimitFlag < 1 || delayLimitFlag > MaxDelayLimit:
+		return fmt.Errorf("delayLimit must be 1 to %d", MaxDelayLimit)
+	case maxCyclesFlag < 1 || maxCyclesFlag > cycleLimitFlag:
+		return fmt.Errorf("maxCycles must be 1 to %d (cycleLimit)", cycleLimitFlag)
+	case goroutinesFlag < 1 || goroutinesFlag > gorLimitFlag:
+		return fmt.Errorf("goroutines must be 1 to %d (goroutineLimit)", gorLimitFlag)
+	case magFactorFlag < 1 || magFactorFlag > 20:
+		return fmt.Errorf("magFactor must be 1 to 20")
+	case saveImageFlag && len(saveDirFlag) == 0:
+		return fmt.Errorf("saveDir is required to save images")
+	case readTimeout <= 0 || writeTimeout <= 0 || idleTimeout <= 0 || shutdownTimeout <= 0:
+		return fmt.Errorf("server timeouts must be positive")
+	case (len(certFile) == 0) != (len(keyFile) == 0):
+		return fmt.Errorf("cert and key must be set together")
+	case workerLimitFlag < 1 || queueLimitFlag < 1:
+		return fmt.Errorf("workerLimit and queueLimit must be positive")
+	case maxRunsFlag < 0 || maxRunBytesFlag < 0 || maxRunAgeFlag < 0:
+		return fmt.Errorf("maxRuns, maxRunBytes and maxRunAge cannot be negative")
+	}
+	if _, _, err = net.SplitHostPort(spec); err != nil {
+		return fmt.Errorf("bad addr: %v", err)
+	}
+	return
+}
+
+// Push flag values into the game and policies.
+func applyConfig() (err error) {
+	err = setLoadPolicy()
+	if err != nil {
+		return
+	}
+	CurrentLimits = &RunLimits{MaxCycles: cycleLimitFlag, MaxGoroutines: gorLimitFlag,
+		MaxDelay: delayLimitFlag}
+	CoreGame.SetDefaults(maxCyclesFlag, goroutinesFlag, autoTuneFlag)
+	if s := RunScheduler; s != nil {
+		s.SetLimits(workerLimitFlag, queueLimitFlag)
+	}
+	err = loadAuthFile(authFileFlag)
+	if err != nil {
+		return
+	}
+	retention := Retention{MaxRuns: maxRunsFlag, MaxBytes: maxRunBytesFlag, MaxAge: maxRunAgeFlag}
+	for _, g := range allGames() {
+		g.SetRetention(retention)
+	}
+	return
+}
+
+// Read a flat configuration file; the format is chosen by extension.
+func readConfigFile(path string) (values map[string]string, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		values, err = parseJSONConfig(b)
+	case ".yaml", ".yml":
+		values, err = parseKeyValueConfig(string(b), ":")
+	case ".toml":
+		values, err = parseKeyValueConfig(string(b), "=")
+	default:
+		err = fmt.Errorf("unknown config file type %q; want .json, .yaml or .toml", path)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+	return
+}
+
+// Parse a JSON object; arrays become comma separated lists.
+func parseJSONConfig(b []byte) (values map[string]string, err error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber() // keep integers exact
+	if err = decoder.Decode(&raw); err != nil {
+		return
+	}
+	values = make(map[string]string)
+	for k, v := range raw {
+		switch xv := v.(type) {
+		case []interface{}:
+			var items []string
+			for _, item := range xv {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[k] = strings.Join(items, ",")
+		case map[string]interface{}, nil:
+			return nil, fmt.Errorf("setting %q must be a simple value or list", k)
+		default:
+			values[k] = fmt.Sprint(xv)
+		}
+	}
+	return
+}
+
+// Parse the flat subset of YAML ("key: value") or TOML ("key = value")
+// used for settings. Comments (#), quoted strings and [a, b] lists are
+// supported; TOML tables and YAML nesting are not.
+func parseKeyValueConfig(text, sep string) (values map[string]string, err error) {
+	values = make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if len(line) == 0 || line == "---" {
+			continue
+		}
+		parts := strings.SplitN(line, sep, 2)
+		if len(parts) != 2 || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "- ") {
+			return nil, fmt.Errorf("line %d: unsupported %q", lineNo, line)
+		}
+		k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+			var items []string
+			for _, item := range splitList(v[1 : len(v)-1]) {
+				items = append(items, unquote(item))
+			}
+			v = strings.Join(items, ",")
+		} else {
+			v = unquote(v)
+		}
+		values[unquote(k)] = v
+	}
+	err = scanner.Err()
+	return
+}
+
+// Remove a # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// Output the effective configuration as JSON.
+func PrintConfig() (err error) {
+	ba, err := json.MarshalIndent(EffectiveConfig(), "", "  ") // keys sorted
+	if err != nil {
+		return
+	}
+	_, err = fmt.Println(string(ba))
+	return
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Comparing runs.
+// Run A from cycle i is compared with run B from cycle j: the first pair of
+// grids in detail, then each later pair (i+1 with j+1, ...) by population
+// and Hamming distance (cells that differ). Grids of different sizes are
+// compared over the larger size; cells off a grid are dead.
+
+// One side of a comparison.
+type XDiffSide struct {
+	Run        string `json:"run" xml:"Run"`
+	Cycle      int    `json:"cycle" xml:"Cycle"`
+	Rule       string `json:"rule" xml:"Rule"`
+	Kernel     string `json:"kernel" xml:"Kernel"`
+	Goroutines int    `json:"goroutineCount" xml:"GoroutineCount"`
+	Population int    `json:"population" xml:"Population"`
+}
+
+// A comparison of one pair of grids after the first.
+type XDiffStep struct {
+	Offset          int `json:"offset" xml:"Offset"`
+	CycleA          int `json:"cycleA" xml:"CycleA"`
+	CycleB          int `json:"cycleB" xml:"CycleB"`
+	PopulationA     int `json:"populationA" xml:"PopulationA"`
+	PopulationB     int `json:"populationB" xml:"PopulationB"`
+	PopulationDelta int `json:"populationDelta" xml:"PopulationDelta"` // B - A
+	Hamming         int `json:"hamming" xml:"Hamming"`
+}
+
+// A comparison of two runs.
+type XDiff struct {
+	A               *XDiffSide   `json:"a" xml:"A"`
+	B               *XDiffSide   `json:"b" xml:"B"`
+	Width           int          `json:"width" xml:"Width"`
+	Height          int          `json:"height" xml:"Height"`
+	OnlyA           int          `json:"onlyA" xml:"OnlyA"` // live only in A
+	OnlyB           int          `json:"onlyB" xml:"OnlyB"`
+	Both            int          `json:"both" xml:"Both"`
+	Hamming         int          `json:"hamming" xml:"Hamming"`
+	Identical       bool         `json:"identical" xml:"Identical"`             // all pairs
+	FirstDifference int          `json:"firstDifference" xml:"FirstDifference"` // offset; -1 if none
+	Steps           []*XDiffStep `json:"steps" xml:"Steps>Step"`
+}
+
+// Maximum frames in a diff GIF.
+const maxDiffFrames = 100
+
+// Diff color indexes.
+const (
+	diffOffIndex = iota
+	diffBothIndex
+	diffOnlyAIndex
+	diffOnlyBIndex
+)
+
+// Diff color palette: dead, live in both, live only in A, live only in B.
+var paletteDiff = []color.Color{color.White, color.Black,
+	color.RGBA{0xd0, 0x20, 0x20, 0xff}, color.RGBA{0x20, 0x40, 0xd0, 0xff}}
+
+// Get the grids of a run from a cycle on (the initial grid is cycle 0).
+func (gr *GameRun) gridsFrom(cycle int) (grids []*Grid, err error) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	if cycle < 0 || cycle > len(gr.Cycles) {
+		err = fmt.Errorf("%w: run %s cycle %d; run has %d cycles", BadIndexError,
+			gr.Name, cycle, len(gr.Cycles))
+		return
+	}
+	if cycle == 0 {
+		grids = append(grids, gr.InitialGrid)
+	}
+	for _, gc := range gr.Cycles[maxInt(cycle-1, 0):] {
+		grids = append(grids, gc.AfterGrid)
+	}
+	return
+}
+
+// Count cells live in only one or in both grids (in world coordinates).
+func compareGrids(ga, gb *Grid) (onlyA, onlyB, both int) {
+	x0, y0, w, h := gridUnion([]*Grid{ga, gb})
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			a, b := ga.getWorldCell(x, y) != 0, gb.getWorldCell(x, y) != 0
+			switch {
+			case a && b:
+				both++
+			case a:
+				onlyA++
+			case b:
+				onlyB++
+			}
+		}
+	}
+	return
+}
+
+// Compare run a from cycle i with run b from cycle j, for at most steps
+// pairs after the first (all pairs if steps < 0).
+func DiffRuns(a *GameRun, i int, b *GameRun, j int, steps int) (xd *XDiff, err error) {
+	gridsA, err := a.gridsFrom(i)
+	if err != nil {
+		return
+	}
+	gridsB, err := b.gridsFrom(j)
+	if err != nil {
+		return
+	}
+	n := minInt(len(gridsA), len(gridsB)) - 1
+	if steps >= 0 && steps < n {
+		n = steps
+	}
+	ga, gb := gridsA[0], gridsB[0]
+	xd = &XDiff{
+		A: &XDiffSide{Run: a.Name, Cycle: i, Rule: a.Rule.String(), Kernel: a.Kernel,
+			Goroutines: a.GoroutineCount, Population: gridPopulation(ga)},
+		B: &XDiffSide{Run: b.Name, Cycle: j, Rule: b.Rule.String(), Kernel: b.Kernel,
+			Goroutines: b.GoroutineCount, Population: gridPopulation(gb)},
+		Width: maxInt(ga.Width, gb.Width), Height: maxInt(ga.Height, gb.Height),
+		FirstDifference: -1, Steps: []*XDiffStep{}}
+	xd.OnlyA, xd.OnlyB, xd.Both = compareGrids(ga, gb)
+	xd.Hamming = xd.OnlyA + xd.OnlyB
+	if xd.Hamming > 0 {
+		xd.FirstDifference = 0
+	}
+	for t := 1; t <= n; t++ {
+		onlyA, onlyB, both := compareGrids(gridsA[t], gridsB[t])
+		step := &XDiffStep{Offset: t, CycleA: i + t, CycleB: j + t,
+			PopulationA: onlyA + both, PopulationB: onlyB + both,
+			PopulationDelta: onlyB - onlyA, Hamming: onlyA + onlyB}
+		if step.Hamming > 0 && xd.FirstDifference < 0 {
+			xd.FirstDifference = t
+		}
+		xd.Steps = append(xd.Steps, step)
+	}
+	xd.Identical = xd.FirstDifference < 0
+	return
+}
+
+// Make a diff image of two grids.
+func makeDiffImage(ga, gb *Grid) (img *image.Paletted) {
+	mag := magFactorFlag
+	x0, y0, w, h := gridUnion([]*Grid{ga, gb})
+	img = image.NewPaletted(image.Rect(0, 0, mag*w+1, mag*h+1), paletteDiff)
+	for row := 0; row < h; row++ {
+		for col := 0; col < w; col++ {
+			a, b := ga.getWorldCell(x0+col, y0+row) != 0, gb.getWorldCell(x0+col, y0+row) != 0
+			index := diffOffIndex
+			switch {
+			case a && b:
+				index = diffBothIndex
+			case a:
+				index = diffOnlyAIndex
+			case b:
+				index = diffOnlyBIndex
+			}
+			// apply magnification
+			for i := 0; i < mag; i++ {
+				for j := 0; j < mag; j++ {
+					img.SetColorIndex(mag*col+j, mag*row+i, uint8(index))
+				}
+			}
+		}
+	}
+	return
+}
+
+// Write a PNG of the difference of run a at cycle i and run b at cycle j.
+func MakeDiffPNG(w io.Writer, a *GameRun, i int, b *GameRun, j int) (err error) {
+	gridsA, err := a.gridsFrom(i)
+	if err != nil {
+		return
+	}
+	gridsB, err := b.gridsFrom(j)
+	if err != nil {
+		return
+	}
+	err = png.Encode(w, makeDiffImage(gridsA[0], gridsB[0]))
+	return
+}
+
+// Make an animated GIF of the differences of run a from cycle i and run b
+// from cycle j (at most count frames).
+func MakeDiffGIF(a *GameRun, i int, b *GameRun, j int, count int) (agif *gif.GIF, err error) {
+	gridsA, err := a.gridsFrom(i)
+	if err != nil {
+		return
+	}
+	gridsB, err := b.gridsFrom(j)
+	if err != nil {
+		return
+	}
+	agif = &gif.GIF{LoopCount: 5}
+	for t := 0; t < len(gridsA) && t < len(gridsB) && t < count; t++ {
+		agif.Image = append(agif.Image, makeDiffImage(gridsA[t], gridsB[t]))
+		agif.Delay = append(agif.Delay, a.DelayIn10ms)
+	}
+	return
+}
+
+// Output a diff summary as text.
+func PrintDiff(out io.Writer, xd *XDiff) {
+	for _, s := range []struct {
+		label string
+		side  *XDiffSide
+	}{{"A", xd.A}, {"B", xd.B}} {
+		fmt.Fprintf(out, "%s: %s cycle %d (rule %s, kernel %s, %d goroutines), population %d\n",
+			s.label, s.side.Run, s.side.Cycle, s.side.Rule, s.side.Kernel,
+			s.side.Goroutines, s.side.Population)
+	}
+	fmt.Fprintf(out, "only A %d, only B %d, both %d, Hamming distance %d\n",
+		xd.OnlyA, xd.OnlyB, xd.Both, xd.Hamming)
+	if len(xd.Steps) > 0 {
+		fmt.Fprintf(out, "%6s %7s %7s %12s %12s %8s %8s\n", "offset", "cycle A", "cycle B",
+			"population A", "population B", "delta", "hamming")
+		for _, s := range xd.Steps {
+			fmt.Fprintf(out, "%6d %7d %7d %12d %12d %8d %8d\n", s.Offset, s.CycleA, s.CycleB,
+				s.PopulationA, s.PopulationB, s.PopulationDelta, s.Hamming)
+		}
+	}
+	switch {
+	case xd.Identical:
+		fmt.Fprintf(out, "identical for %d cycles\n", len(xd.Steps)+1)
+	default:
+		fmt.Fprintf(out, "first difference at offset %d\n", xd.FirstDifference)
+	}
+}
+
+// Diff request handler.
+//
+//	GET /diff?a=run&i=cycle&b=run&j=cycle&steps=n
+//
+// b defaults to a; i and j default to 0; steps defaults to all. Returns
+// JSON or XML (XDiff), a PNG of the first pair or a GIF of every pair.
+func diffHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.Header().Set("Allow", "GET")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	ct, ok := negotiate(request, jsonType, xmlType, pngType, gifType)
+	if !ok {
+		sendError(writer, 406, "supported types: %s, %s, %s, %s", jsonType, xmlType, pngType, gifType)
+		return
+	}
+	query := request.URL.Query()
+	nameA, nameB := query.Get("a"), query.Get("b")
+	if len(nameA) == 0 {
+		sendError(writer, 400, "run a is required")
+		return
+	}
+	if len(nameB) == 0 {
+		nameB = nameA
+	}
+	game := requestGame(request)
+	a, ok := game.ViewRun(nameA)
+	if !ok {
+		sendError(writer, 404, "run %q not found", nameA)
+		return
+	}
+	b, ok := game.ViewRun(nameB)
+	if !ok {
+		sendError(writer, 404, "run %q not found", nameB)
+		return
+	}
+	values := map[string]int{"i": 0, "j": 0, "steps": -1}
+	for k := range values {
+		if v := query.Get(k); len(v) > 0 {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				sendError(writer, 400, "bad %s %q", k, v)
+				return
+			}
+			values[k] = n
+		}
+	}
+	i, j, steps := values["i"], values["j"], values["steps"]
+	var buf bytes.Buffer
+	var err error
+	switch ct {
+	case pngType:
+		err = MakeDiffPNG(&buf, a, i, b, j)
+	case gifType:
+		count := maxDiffFrames
+		if steps >= 0 && steps+1 < count {
+			count = steps + 1
+		}
+		var agif *gif.GIF
+		if agif, err = MakeDiffGIF(a, i, b, j, count); err == nil {
+			err = gif.EncodeAll(&buf, agif)
+		}
+	default:
+		var xd *XDiff
+		if xd, err = DiffRuns(a, i, b, j, steps); err == nil {
+			sendValue(writer, 200, ct, xd)
+			return
+		}
+	}
+	switch {
+	case errors.Is(err, BadIndexError):
+		sendError(writer, 400, "%v", err)
+	case err != nil:
+		sendError(writer, 500, "cannot make image: %v", err)
+	default:
+		writer.Header().Set("Content-Type", ct)
+		writer.Write(buf.Bytes()) // send response; error ignored
+	}
+}
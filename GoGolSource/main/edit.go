@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Editing a run's current grid.
+// Edits (and continuing a run after edits) are recorded as events so a run
+// can be replayed from its seed.
+
+// Edit operations.
+const (
+	setOp    = "set"    // set a cell (to Value, default alive)
+	toggleOp = "toggle" // flip a cell
+	clearOp  = "clear"  // kill the cells in a rectangle
+	stampOp  = "stamp"  // place a pattern at X, Y
+)
+
+// Stamp modes.
+const (
+	copyMode = "copy" // pattern cells (live and dead) replace the grid's
+	orMode   = "or"   // pattern live cells are added to the grid's
+)
+
+// An edit of a run's grid.
+// A stamp's pattern is a library pattern name, a URL (any seed URL, ex.
+// "pattern:", "random:" or "file:") or an inline seed (base64 in JSON);
+// once applied it is recorded as RLE.
+type XEdit struct {
+	Op      string `json:"op" xml:"Op"`
+	X       int    `json:"x" xml:"X"`
+	Y       int    `json:"y" xml:"Y"`
+	W       int    `json:"w,omitempty" xml:"W,omitempty"`
+	H       int    `json:"h,omitempty" xml:"H,omitempty"`
+	Value   *int   `json:"value,omitempty" xml:"Value,omitempty"`
+	Pattern string `json:"pattern,omitempty" xml:"Pattern,omitempty"`
+	Source  string `json:"source,omitempty" xml:"Source,omitempty"`
+	Seed    []byte `json:"seed,omitempty" xml:"Seed,omitempty"`
+	RLE     string `json:"rle,omitempty" xml:"RLE,omitempty"`
+	Rotate  int    `json:"rotate,omitempty" xml:"Rotate,omitempty"` // clockwise degrees
+	Flip    bool   `json:"flip,omitempty" xml:"Flip,omitempty"`     // left to right, before rotating
+	Mode    string `json:"mode,omitempty" xml:"Mode,omitempty"`
+}
+
+// Event kinds.
+const (
+	editEvent     = "edit"
+	continueEvent = "continue"
+)
+
+// Something done to a run after it was created.
+type RunEvent struct {
+	Kind    string
+	Cycle   int // cycles played before the event
+	At      time.Time
+	Edits   []*XEdit // for edits
+	Changed int      // cells changed by edits
+	Cycles  int      // for continue, cycles played; for rewind, the cycle
+}
+
+// A run event as returned to clients.
+type XRunEvent struct {
+	Kind    string   `json:"kind" xml:"Kind"`
+	Cycle   int      `json:"cycle" xml:"Cycle"`
+	At      int64    `json:"atNS" xml:"AtEpochNS"`
+	Edits   []*XEdit `json:"edits,omitempty" xml:"Edits>Edit,omitempty"`
+	Changed int      `json:"changed,omitempty" xml:"Changed,omitempty"`
+	Cycles  int      `json:"cycles,omitempty" xml:"Cycles,omitempty"`
+}
+
+// A list of run events as returned to clients.
+type XRunEventList struct {
+	XMLName xml.Name     `json:"-" xml:"Events"`
+	Events  []*XRunEvent `json:"events" xml:"Event"`
+}
+
+// Error values.
+var (
+	BadEditError       = errors.New("bad edit")
+	OffBoardError      = errors.New("off the board")
+	TooManyCyclesError = errors.New("too many cycles")
+	RunBusyError       = errors.New("run is playing")
+)
+
+// Apply edits to the current grid.
+// Either all edits are applied (and recorded as one event) or none are.
+func (gr *GameRun) Edit(edits []*XEdit) (err error) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	if gr.busy {
+		return RunBusyError
+	}
+	grid := gr.CurrentGrid.DeepCloneGrid()
+	changed := 0
+	for i, e := range edits {
+		var n int
+		if n, err = e.apply(grid); err != nil {
+			if len(edits) > 1 {
+				err = fmt.Errorf("edit %d: %w", i+1, err)
+			}
+			return
+		}
+		changed += n
+	}
+	gr.CurrentGrid = grid
+	gr.FinalGrid = grid.DeepCloneGrid()
+	gr.Events = append(gr.Events, &RunEvent{Kind: editEvent, Cycle: len(gr.Cycles),
+		At: time.Now(), Edits: edits, Changed: changed})
+	return
+}
+
+// Play more cycles from the current grid. The run is busy (other edits
+// fail) until they are played. The context ends waiting in the run queue
+// (ex. when the client goes away); the run lock is not held meanwhile.
+func (gr *GameRun) Continue(ctx context.Context, cycles int) (err error) {
+	gr.lock.Lock()
+	switch limit := CurrentLimits.MaxCycles; {
+	case gr.busy:
+		err = RunBusyError
+	case cycles < 1 || len(gr.Cycles)+cycles > limit:
+		err = fmt.Errorf("%w: run has %d cycles, maximum %d", TooManyCyclesError,
+			len(gr.Cycles), limit)
+	}
+	if err != nil {
+		gr.lock.Unlock()
+		return
+	}
+	gr.busy = true
+	event := &RunEvent{Kind: continueEvent, Cycle: len(gr.Cycles), At: time.Now(),
+		Cycles: cycles}
+	gr.lock.Unlock()
+	defer func() {
+		gr.lock.Lock()
+		defer gr.lock.Unlock()
+		gr.busy = false
+		if err == nil {
+			gr.EndedAt = time.Now()
+			gr.FinalGrid = gr.CurrentGrid.DeepCloneGrid()
+			gr.Events = append(gr.Events, event)
+		}
+	}()
+	start, err := gr.Parent.schedule(gr)
+	if err != nil {
+		return
+	}
+	done, err := start(ctx)
+	if err != nil {
+		return
+	}
+	defer done()
+	for i := 0; i < cycles; i++ {
+		if err = gr.NextCycle(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Apply an edit to a grid; returns the number of cells changed. Edits are
+// at world coordinates (grid coordinates unless the grid is unbounded).
+func (e *XEdit) apply(grid *Grid) (changed int, err error) {
+	ex, ey := e.X-grid.X, e.Y-grid.Y
+	set := func(x, y int, v byte) {
+		if grid.getCell(x, y) != v {
+			grid.setCell(x, y, v)
+			changed++
+		}
+	}
+	switch e.Op {
+	case setOp, toggleOp:
+		if err = checkOnBoard(grid, ex, ey, 1, 1); err != nil {
+			return
+		}
+		v := byte(1)
+		switch {
+		case e.Op == toggleOp:
+			v = 1 - grid.getCell(ex, ey)
+		case e.Value != nil && (*e.Value < 0 || *e.Value > 1):
+			return 0, fmt.Errorf("%w: value must be 0 or 1", BadEditError)
+		case e.Value != nil:
+			v = byte(*e.Value)
+		}
+		set(ex, ey, v)
+	case clearOp:
+		if err = checkOnBoard(grid, ex, ey, e.W, e.H); err != nil {
+			return
+		}
+		for y := ey; y < ey+e.H; y++ {
+			for x := ex; x < ex+e.W; x++ {
+				set(x, y, 0)
+			}
+		}
+	case stampOp:
+		var pattern *Grid
+		if pattern, err = e.stampGrid(); err != nil {
+			return
+		}
+		if err = checkOnBoard(grid, ex, ey, pattern.Width, pattern.Height); err != nil {
+			return
+		}
+		for y := 0; y < pattern.Height; y++ {
+			for x := 0; x < pattern.Width; x++ {
+				if v := pattern.getCell(x, y); v != 0 || e.Mode != orMode {
+					set(ex+x, ey+y, v)
+				}
+			}
+		}
+	default:
+		err = fmt.Errorf("%w: unknown op %q; want %s, %s, %s or %s", BadEditError,
+			e.Op, setOp, toggleOp, clearOp, stampOp)
+	}
+	return
+}
+
+// Get a stamp's pattern, rotated and reflected. The pattern is recorded
+// (as RLE) in the edit so the edit can be replayed.
+func (e *XEdit) stampGrid() (grid *Grid, err error) {
+	switch e.Mode {
+	case "", copyMode, orMode:
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q; want %s or %s", BadEditError,
+			e.Mode, copyMode, orMode)
+	}
+	if e.Rotate%90 != 0 || e.Rotate < 0 || e.Rotate >= 360 {
+		return nil, fmt.Errorf("%w: rotate must be 0, 90, 180 or 270", BadEditError)
+	}
+	switch {
+	case len(e.RLE) > 0:
+		grid, err = ParseRLE(e.RLE)
+	case len(e.Pattern) > 0:
+		grid, err = LoadPattern(PatternPrefix + e.Pattern)
+	case len(e.Source) > 0:
+		grid, _, err = LoadSeed(e.Source)
+	case len(e.Seed) > 0:
+		grid, _, err = DecodeSeed(e.Seed)
+	default:
+		err = fmt.Errorf("%w: stamp needs a pattern, source, seed or rle", BadEditError)
+	}
+	if err != nil {
+		return
+	}
+	e.RLE, e.Seed = FormatRLE(grid, ConwayRule), nil
+	t := e.Rotate / 90
+	if e.Flip {
+		t += 4
+	}
+	grid = TransformGrid(grid, t)
+	return
+}
+
+// Check a rectangle is on a grid.
+func checkOnBoard(grid *Grid, x, y, w, h int) (err error) {
+	if w < 1 || h < 1 {
+		return fmt.Errorf("%w: width and height must be positive", BadEditError)
+	}
+	if x < 0 || y < 0 || x+w > grid.Width || y+h > grid.Height {
+		err = fmt.Errorf("%w: %dx%d at %d,%d on a %dx%d board", OffBoardError,
+			w, h, x, y, grid.Width, grid.Height)
+	}
+	return
+}
+
+// Make the client form of a run's events.
+func makeReturnedEvents(gr *GameRun) (events []*XRunEvent) {
+	events = []*XRunEvent{}
+	for _, ev := range gr.Events {
+		events = append(events, &XRunEvent{Kind: ev.Kind, Cycle: ev.Cycle,
+			At: ev.At.UnixNano(), Edits: ev.Edits, Changed: ev.Changed, Cycles: ev.Cycles})
+	}
+	return
+}
+
+// Repeat recorded events on a run (ex. when replaying a saved run).
+func (gr *GameRun) ReplayEvents(events []*XRunEvent) (err error) {
+	for i, ev := range events {
+		switch ev.Kind {
+		case editEvent:
+			err = gr.Edit(ev.Edits)
+		case continueEvent:
+			err = gr.Continue(context.Background(), ev.Cycles)
+		case rewindEvent:
+			err = gr.Rewind(ev.Cycles)
+		default:
+			err = fmt.Errorf("unknown event kind %q", ev.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("event %d: %w", i+1, err)
+		}
+	}
+	return
+}
+
+// Parse a CLI edit: comma separated numbers for set (x,y[,value]), toggle
+// (x,y) and clear (x,y,w,h); for stamp, pattern@x,y[,rotate][,flip] where
+// pattern is a library name or a URL.
+func ParseEdit(op, text string) (e *XEdit, err error) {
+	e = &XEdit{Op: op}
+	args := text
+	if op == stampOp {
+		at := strings.LastIndex(text, "@")
+		if at < 0 {
+			return nil, fmt.Errorf("%w: want pattern@x,y[,rotate][,flip]", BadEditError)
+		}
+		if _, ok := Patterns[text[:at]]; ok {
+			e.Pattern = text[:at]
+		} else {
+			e.Source = argumentURL(text[:at])
+		}
+		args = text[at+1:]
+	}
+	parts := strings.Split(args, ",")
+	if op == stampOp && len(parts) > 2 && parts[len(parts)-1] == "flip" {
+		e.Flip = true
+		parts = parts[:len(parts)-1]
+	}
+	var values []int
+	for _, p := range parts {
+		var v int
+		if _, err = fmt.Sscanf(strings.TrimSpace(p), "%d", &v); err != nil {
+			return nil, fmt.Errorf("%w: bad number %q", BadEditError, p)
+		}
+		values = append(values, v)
+	}
+	counts := map[string][2]int{setOp: {2, 3}, toggleOp: {2, 2}, clearOp: {4, 4}, stampOp: {2, 3}}
+	if n := counts[op]; len(values) < n[0] || len(values) > n[1] {
+		return nil, fmt.Errorf("%w: %s needs %d to %d numbers", BadEditError, op, n[0], n[1])
+	}
+	e.X, e.Y = values[0], values[1]
+	switch {
+	case op == setOp && len(values) == 3:
+		e.Value = &values[2]
+	case op == clearOp:
+		e.W, e.H = values[2], values[3]
+	case op == stampOp && len(values) == 3:
+		e.Rotate = values[2]
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rewinding and forking runs.
+// A run can be rewound to any recorded cycle (later cycles are discarded)
+// or forked at a cycle into a new run, optionally with another rule or
+// with edits to the grid at the fork. Continuing a run (see Continue)
+// resumes it from its current grid.
+
+const rewindEvent = "rewind"
+
+// Where a forked run came from.
+type XLineage struct {
+	Parent string   `json:"parent" xml:"Parent"`
+	Cycle  int      `json:"cycle" xml:"Cycle"` // parent cycle forked
+	Edits  []*XEdit `json:"edits,omitempty" xml:"Edits>Edit,omitempty"`
+}
+
+// Get (a copy of) the grid at a cycle; 0 is the initial grid.
+func (gr *GameRun) GridAt(cycle int) (grid *Grid, err error) {
+	switch {
+	case cycle < 0 || cycle > len(gr.Cycles):
+		err = fmt.Errorf("%w: cycle %d; run has %d cycles", BadIndexError, cycle, len(gr.Cycles))
+	case cycle == 0:
+		grid = gr.InitialGrid.DeepCloneGrid()
+	default:
+		grid = gr.Cycles[cycle-1].AfterGrid.DeepCloneGrid()
+	}
+	return
+}
+
+// Rewind the current grid to a cycle, discarding later cycles.
+// Edits made after the cycle are undone.
+func (gr *GameRun) Rewind(cycle int) (err error) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	if gr.busy {
+		return RunBusyError
+	}
+	grid, err := gr.GridAt(cycle)
+	if err != nil {
+		return
+	}
+	gr.Events = append(gr.Events, &RunEvent{Kind: rewindEvent, Cycle: len(gr.Cycles),
+		At: time.Now(), Cycles: cycle})
+	gr.Cycles = gr.Cycles[:cycle]
+	gr.CurrentGrid = grid
+	gr.FinalGrid = grid.DeepCloneGrid()
+	return
+}
+
+// Fork a run at a cycle into a new run.
+// The new run starts with the parent's grid at the cycle (with any edits)
+// and the parent's settings (unless set in params). It plays params.Cycles
+// cycles; by default as many as the parent played after the cycle.
+func (g *Game) Fork(parent *GameRun, cycle int, name string, params RunParams,
+	edits []*XEdit) (gr *GameRun, err error) {
+	parent.lock.Lock()
+	grid, err := parent.GridAt(cycle)
+	remaining := len(parent.Cycles) - cycle
+	goroutines, tileSize := parent.GoroutineCount, parent.TileSize // may be tuning
+	parent.lock.Unlock()
+	if err != nil {
+		return
+	}
+	lineage := &XLineage{Parent: parent.Name, Cycle: cycle, Edits: edits}
+	for i, e := range edits {
+		if _, err = e.apply(grid); err != nil {
+			return nil, fmt.Errorf("edit %d: %w", i+1, err)
+		}
+	}
+	gr = NewGameRunFromGrid(name, fmt.Sprintf("fork:%s@%d", parent.Name, cycle), grid, g)
+	gr.Rule, gr.Kernel, gr.GoroutineCount = parent.Rule, parent.Kernel, goroutines
+	gr.Topology, gr.DelayIn10ms = parent.Topology, parent.DelayIn10ms
+	gr.TileSize = tileSize
+	gr.MaxCycles = remaining
+	gr.Lineage = lineage
+	err = g.runNew(gr, params)
+	return
+}
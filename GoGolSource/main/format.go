@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Response formatters.
+// Like the Java Formatter, JsonFormatter and XmlFormatter, a formatter
+// turns a value into text. Structured responses are JSON, XML, YAML or
+// newline-delimited JSON (one line per run of a list); run metadata can
+// also be CSV, one row per cycle. negotiate chooses the media type from
+// the format parameter or the Accept header (with q-values).
+
+// Formatted media types (beyond JSON and XML).
+const (
+	csvType    = "text/csv"
+	yamlType   = "application/yaml"
+	ndjsonType = "application/x-ndjson"
+)
+
+// Define a formatter (value to text).
+type Formatter interface {
+	ValueToText(v interface{}) ([]byte, error)
+}
+
+// Error values.
+var NotTabularError = errors.New("value has no tabular form")
+
+// Formatters by media type.
+var Formatters = map[string]Formatter{
+	jsonType:   &JSONFormatter{Pretty: true},
+	xmlType:    &XMLFormatter{Pretty: true},
+	csvType:    &CSVFormatter{},
+	yamlType:   &YAMLFormatter{},
+	ndjsonType: &NDJSONFormatter{},
+}
+
+// Response types for run metadata; the first is the default.
+var runTypes = []string{jsonType, xmlType, csvType, yamlType, ndjsonType}
+
+// Other names clients use for formatted media types.
+var mediaTypeAliases = map[string]string{
+	"text/json":          jsonType,
+	"text/xml":           xmlType,
+	"text/yaml":          yamlType,
+	"text/x-yaml":        yamlType,
+	"application/x-yaml": yamlType,
+	"application/ndjson": ndjsonType,
+}
+
+// Get the canonical name of a media type.
+func canonicalType(mt string) string {
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	if alias, ok := mediaTypeAliases[mt]; ok {
+		return alias
+	}
+	return mt
+}
+
+// A JSON formatter.
+type JSONFormatter struct {
+	Pretty bool
+}
+
+func (f *JSONFormatter) String() string {
+	return fmt.Sprintf("JSONFormatter[pretty=%v]", f.Pretty)
+}
+
+func (f *JSONFormatter) ValueToText(v interface{}) ([]byte, error) {
+	if f.Pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// An XML formatter.
+type XMLFormatter struct {
+	Pretty bool
+}
+
+func (f *XMLFormatter) String() string {
+	return fmt.Sprintf("XMLFormatter[pretty=%v]", f.Pretty)
+}
+
+func (f *XMLFormatter) ValueToText(v interface{}) ([]byte, error) {
+	if f.Pretty {
+		return xml.MarshalIndent(v, "", "  ")
+	}
+	return xml.Marshal(v)
+}
+
+// A newline-delimited JSON formatter: one line per run of a list (or
+// game), else one line.
+type NDJSONFormatter struct{}
+
+func (f *NDJSONFormatter) ValueToText(v interface{}) (text []byte, err error) {
+	var out bytes.Buffer
+	for _, r := range records(v) {
+		var line []byte
+		line, err = json.Marshal(r)
+		if err != nil {
+			return
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// A CSV formatter for runs: one row per cycle of each run.
+type CSVFormatter struct{}
+
+// CSV column names.
+var csvHeader = []string{"run", "cycle", "startedAtNS", "endedAtNS", "durationMS",
+	"goroutineCount", "maximumCycles", "population", "checksum", "tiles", "activeTiles"}
+
+func (f *CSVFormatter) ValueToText(v interface{}) (text []byte, err error) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Write(csvHeader) // error reported by Flush
+	for _, r := range records(v) {
+		xr, ok := r.(*XGameRun)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", NotTabularError, r)
+		}
+		for _, xc := range xr.Cycles {
+			w.Write([]string{xr.Name, strconv.Itoa(xc.Cycle),
+				strconv.FormatInt(xc.StartedAt, 10), strconv.FormatInt(xc.EndedAt, 10),
+				strconv.FormatInt(xc.Duration, 10), strconv.Itoa(xc.GorountineCount),
+				strconv.Itoa(xc.MaxCycles), strconv.Itoa(xc.Population), xc.Checksum,
+				strconv.Itoa(xc.Tiles), strconv.Itoa(xc.ActiveTiles)})
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return
+	}
+	return out.Bytes(), nil
+}
+
+// Split a value into records: the runs of a game (by name) or run list,
+// else the value itself.
+func records(v interface{}) (rs []interface{}) {
+	switch v := v.(type) {
+	case *XGame:
+		names := make([]string, 0, len(v.Runs))
+		for name := range v.Runs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rs = append(rs, v.Runs[name])
+		}
+	case *XRunList:
+		for _, xr := range v.Runs {
+			rs = append(rs, xr)
+		}
+	default:
+		rs = []interface{}{v}
+	}
+	return
+}
+
+// A YAML formatter. Values are converted as for JSON (so field names
+// match) and written in block style.
+type YAMLFormatter struct{}
+
+func (f *YAMLFormatter) ValueToText(v interface{}) (text []byte, err error) {
+	ba, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(ba))
+	dec.UseNumber()
+	tree, err := decodeOrdered(dec)
+	if err != nil {
+		return
+	}
+	var out strings.Builder
+	out.WriteString("---\n")
+	writeYAML(&out, tree, 0, false)
+	return []byte(out.String()), nil
+}
+
+// A JSON object with its keys in order.
+type orderedObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// Decode a JSON value keeping object key order. Objects are
+// *orderedObject, arrays []interface{} and scalars as json.Token.
+func decodeOrdered(dec *json.Decoder) (v interface{}, err error) {
+	t, err := dec.Token()
+	if err != nil {
+		return
+	}
+	switch t {
+	case json.Delim('{'):
+		o := &orderedObject{}
+		for dec.More() {
+			var key json.Token
+			var value interface{}
+			if key, err = dec.Token(); err != nil {
+				return
+			}
+			if value, err = decodeOrdered(dec); err != nil {
+				return
+			}
+			o.keys = append(o.keys, key.(string))
+			o.values = append(o.values, value)
+		}
+		_, err = dec.Token() // '}'
+		return o, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			var value interface{}
+			if value, err = decodeOrdered(dec); err != nil {
+				return
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token() // ']'
+		return list, err
+	}
+	return t, nil
+}
+
+// Report if a value is written as a YAML block (not on one line).
+func isYAMLBlock(v interface{}) bool {
+	switch v := v.(type) {
+	case *orderedObject:
+		return len(v.keys) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// Write a value as YAML at an indent. If inline the first line continues
+// the current one (after "- ").
+func writeYAML(out *strings.Builder, v interface{}, indent int, inline bool) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case *orderedObject:
+		if len(v.keys) == 0 {
+			out.WriteString("{}\n")
+			return
+		}
+		for i, key := range v.keys {
+			if i > 0 || !inline {
+				out.WriteString(pad)
+			}
+			out.WriteString(yamlString(key) + ":")
+			if isYAMLBlock(v.values[i]) {
+				out.WriteString("\n")
+				writeYAML(out, v.values[i], indent+2, false)
+			} else {
+				out.WriteString(" ")
+				writeYAML(out, v.values[i], indent+2, true)
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString("[]\n")
+			return
+		}
+		for i, e := range v {
+			if i > 0 || !inline {
+				out.WriteString(pad)
+			}
+			out.WriteString("- ")
+			writeYAML(out, e, indent+2, true)
+		}
+	case string:
+		out.WriteString(yamlString(v) + "\n")
+	case nil:
+		out.WriteString("null\n")
+	default: // json.Number or bool
+		out.WriteString(fmt.Sprint(v) + "\n")
+	}
+}
+
+// Strings that can be written unquoted.
+var plainYAML = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./+-]*$`)
+
+// Strings that are not plain strings in YAML.
+var reservedYAML = map[string]bool{"true": true, "false": true, "null": true,
+	"yes": true, "no": true, "on": true, "off": true, "y": true, "n": true}
+
+// Write a YAML string, quoted if needed (JSON quoting is valid YAML).
+func yamlString(s string) string {
+	if plainYAML.MatchString(s) && !reservedYAML[strings.ToLower(s)] {
+		return s
+	}
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s) // cannot fail
+	return strings.TrimSuffix(out.String(), "\n")
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc64"
 	"image"
 	"image/color"
 	"image/gif"
@@ -12,16 +15,20 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Default game history.
 var CoreGame = &Game{
-	make(map[string]*GameRun),
-	10,
-	0,
-	1}
+	Runs:           make(map[string]*GameRun),
+	MaxCycles:      10,
+	SkipCycles:     0,
+	GoroutineCount: 1}
 
 // Represents a game.
 type Game struct {
@@ -29,21 +36,230 @@ type Game struct {
 	MaxCycles      int
 	SkipCycles     int // not currently used
 	GoroutineCount int
+	AutoTune       bool           // auto-tune runs not setting goroutines
+	Quiet          bool           // suppress run progress output
+	Retention      Retention      // limits on runs held
+	lock           sync.Mutex     // guards Runs, run pins and views
+	active         sync.WaitGroup // runs in progress
+	evictions      []*XEviction   // recent, oldest first
+}
+
+// Limits on run settings.
+const (
+	MaxCyclesLimit     = 100_000
+	MaxGoroutinesLimit = 1024
+	MaxDelayLimit      = 100 * 100 // 100s
+)
+
+// Default GIF frame delay (10ms units).
+const DefaultDelayIn10ms = 5 * 100
+
+// Limits on per run settings; at most the constant limits.
+type RunLimits struct {
+	MaxCycles     int // including continues
+	MaxGoroutines int
+	MaxDelay      int // 10ms units
+}
+
+// Limits applied to run settings (from the server configuration).
+var CurrentLimits = &RunLimits{
+	MaxCycles:     MaxCyclesLimit,
+	MaxGoroutines: MaxGoroutinesLimit,
+	MaxDelay:      MaxDelayLimit,
+}
+
+var BadRunParamError = errors.New("bad run setting")
+
+// Set the default run settings.
+func (g *Game) SetDefaults(maxCycles, goroutineCount int, autoTune bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.MaxCycles, g.GoroutineCount, g.AutoTune = maxCycles, goroutineCount, autoTune
+}
+
+// Optional per run settings; zero values use the Game's settings.
+type RunParams struct {
+	Cycles     int
+	Goroutines int
+	AutoTune   bool // pick goroutines (instead of Goroutines)
+	Rule       string
+	Kernel     string
+	Topology   string
+	Delay      int    // GIF frame delay (10ms units)
+	Pinned     bool   // never evicted
+	Priority   string // in the run queue
+	// Ends waiting in the run queue (ex. when the client goes away).
+	Context context.Context
+	// Admits the run once its grid and cycles are known (ex. under a
+	// quota); a run it refuses is not recorded or played.
+	Admit func(gr *GameRun) error
+}
+
+// Check settings against the current limits.
+func (p RunParams) Check() (err error) {
+	limits := CurrentLimits
+	switch {
+	case p.Cycles < 0 || p.Cycles > limits.MaxCycles:
+		err = fmt.Errorf("%w: cycles must be 0 (the default) to %d", BadRunParamError, limits.MaxCycles)
+	case p.Goroutines < 0 || p.Goroutines > limits.MaxGoroutines:
+		err = fmt.Errorf("%w: goroutines must be 0 (the default) to %d", BadRunParamError, limits.MaxGoroutines)
+	case p.AutoTune && p.Goroutines > 0:
+		err = fmt.Errorf("%w: goroutines must be 0 when auto-tuned", BadRunParamError)
+	case p.Delay < 0 || p.Delay > limits.MaxDelay:
+		err = fmt.Errorf("%w: delay must be 0 (the default) to %d", BadRunParamError, limits.MaxDelay)
+	}
+	if err != nil {
+		return
+	}
+	if len(p.Rule) > 0 {
+		if _, err = ParseRule(p.Rule); err != nil {
+			return
+		}
+	}
+	if _, ok := Kernels[p.Kernel]; len(p.Kernel) > 0 && !ok {
+		return fmt.Errorf("%w: %q; known: %v", UnknownKernelError, p.Kernel, KernelNames())
+	}
+	if _, err = ParseTopology(p.Topology); err != nil {
+		return
+	}
+	_, err = ParsePriority(p.Priority)
+	return
 }
 
 // Run a set of cycles from the grid defined by an image.
 func (g *Game) Run(name, url string) (err error) {
-	gr, err := NewGameRun(name, url, g)
+	_, err = g.RunWith(name, url, RunParams{})
+	return
+}
+
+// Run a set of cycles from the grid defined by an image using the supplied
+// settings. Any existing run with the same name is replaced.
+func (g *Game) RunWith(name, url string, params RunParams) (gr *GameRun, err error) {
+	gr, err = NewGameRun(name, url, g)
 	if err != nil {
 		return
 	}
-	g.Runs[gr.Name] = gr
+	err = g.runNew(gr, params)
+	return
+}
+
+// Run a set of cycles from a supplied grid; source describes its origin.
+// Any existing run with the same name is replaced.
+func (g *Game) RunGrid(name, source string, grid *Grid,
+	params RunParams) (gr *GameRun, err error) {
+	gr = NewGameRunFromGrid(name, source, grid, g)
+	err = g.runNew(gr, params)
+	return
+}
+
+// Record and play a new run.
+func (g *Game) runNew(gr *GameRun, params RunParams) (err error) {
+	g.active.Add(1)
+	defer g.active.Done()
+	err = gr.ApplyParams(params)
+	if err != nil {
+		return
+	}
+	if params.Admit != nil {
+		if err = params.Admit(gr); err != nil {
+			return
+		}
+	}
+	gr.busy = true // until played; not shared yet
+	start, err := g.schedule(gr)
+	if err != nil {
+		return
+	}
+	g.AddRun(gr)
+	done, err := start(params.Context)
+	if err != nil {
+		g.removeRun(gr) // never played
+		return
+	}
 	err = gr.Run()
+	gr.lock.Lock()
+	gr.busy = false
+	gr.lock.Unlock()
+	done()
+	g.Retain()
+	return
+}
+
+// Wait for any runs in progress to finish or the context to end.
+func (g *Game) WaitRuns(ctx context.Context) (err error) {
+	done := make(chan struct{})
+	go func() {
+		g.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// Get a run by name.
+func (g *Game) GetRun(name string) (gr *GameRun, ok bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	gr, ok = g.Runs[name]
+	return
+}
+
+// Add (or replace) a run.
+func (g *Game) AddRun(gr *GameRun) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	gr.ViewedAt = time.Now()
+	g.Runs[gr.Name] = gr
+}
+
+// Remove a run by name; reports if it existed.
+func (g *Game) RemoveRun(name string) (ok bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	_, ok = g.Runs[name]
+	delete(g.Runs, name)
+	return
+}
+
+// Remove a run if it has not been replaced.
+func (g *Game) removeRun(gr *GameRun) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.Runs[gr.Name] == gr {
+		delete(g.Runs, gr.Name)
+	}
+}
+
+// Get the names of all runs in sorted order.
+func (g *Game) RunNames() (names []string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	names = make([]string, 0, len(g.Runs))
+	for k := range g.Runs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Get the total size of all grids held by runs.
+func (g *Game) GridBytes() (n int64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, gr := range g.Runs {
+		n += gr.GridBytes()
+	}
 	return
 }
 
 // Clear a game.
 func (g *Game) Clear() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
 	for k, _ := range g.Runs {
 		delete(g.Runs, k)
 	}
@@ -64,6 +280,91 @@ type GameRun struct {
 	DelayIn10ms    int
 	PlayIndex      int
 	GoroutineCount int
+	MaxCycles      int
+	Rule           *Rule
+	Kernel         string
+	Topology       string
+	Soup           *Soup       // if a random soup
+	Events         []*RunEvent // edits, continues and rewinds after the first run
+	Lineage        *XLineage   // if forked
+	Pinned         bool        // never evicted
+	ViewedAt       time.Time   // last viewed (or added)
+	Priority       string      // in the run queue
+	State          string      // in the run queue; empty if not scheduled
+	QueuedAt       time.Time   // last queued
+	Wait           time.Duration
+	granted        int        // goroutines the scheduler allows; 0 is any
+	TileSize       int        // for the tiles kernel; 0 is the default
+	AutoTune       bool       // pick goroutines and tile size (see tune.go)
+	Tuning         *XTuning   // the auto-tuning decision
+	tiles          *tileState // of the last cycle, for the tiles kernel
+	noHistory      bool       // keep no cycles; grids are reused (ex. by the search)
+	spare          *Grid      // with noHistory, the last cycle's before grid
+	busy           bool       // playing (first run or continue); guarded by lock
+	lock           sync.Mutex // guards grids, cycles, events and tuning; after Parent.lock
+	stateLock      sync.Mutex // guards State, QueuedAt and Wait
+}
+
+// Get the total size of the grids held by a run.
+func (gr *GameRun) GridBytes() (n int64) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	for _, grid := range []*Grid{gr.InitialGrid, gr.CurrentGrid, gr.FinalGrid} {
+		if grid != nil {
+			n += int64(len(grid.Data))
+		}
+	}
+	for _, gc := range gr.Cycles {
+		n += int64(len(gc.BeforeGrid.Data) + len(gc.AfterGrid.Data))
+	}
+	return
+}
+
+// Get a run's grid size and cycles played (so far).
+func (gr *GameRun) size() (width, height, cycles int) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	return gr.Width, gr.Height, len(gr.Cycles)
+}
+
+// Override run settings from the supplied parameters.
+func (gr *GameRun) ApplyParams(params RunParams) (err error) {
+	if params.Cycles > 0 {
+		gr.MaxCycles = params.Cycles
+	}
+	if params.Goroutines > 0 {
+		gr.GoroutineCount, gr.AutoTune = params.Goroutines, false
+	}
+	if params.AutoTune {
+		gr.AutoTune = true
+	}
+	if gr.AutoTune {
+		gr.GoroutineCount = autoGoroutineLimit() // the most calibration tries
+	}
+	if params.Delay > 0 {
+		gr.DelayIn10ms = params.Delay
+	}
+	gr.Pinned = gr.Pinned || params.Pinned
+	if len(params.Priority) > 0 {
+		if gr.Priority, err = ParsePriority(params.Priority); err != nil {
+			return
+		}
+	}
+	if len(params.Topology) > 0 {
+		if gr.Topology, err = ParseTopology(params.Topology); err != nil {
+			return
+		}
+	}
+	if len(params.Kernel) > 0 {
+		if _, ok := Kernels[params.Kernel]; !ok {
+			return fmt.Errorf("%w: %q", UnknownKernelError, params.Kernel)
+		}
+		gr.Kernel = params.Kernel
+	}
+	if len(params.Rule) > 0 {
+		gr.Rule, err = ParseRule(params.Rule)
+	}
+	return
 }
 
 // B & W color indexes
@@ -77,20 +378,30 @@ var paletteBW = []color.Color{color.White, color.Black}
 
 // Generate a PNG result (single frame).
 func (gr *GameRun) MakePNG(writer io.Writer, index int) (err error) {
-	var grid *Grid
-	switch index {
-	case 0:
-		grid = gr.InitialGrid
-	default:
+	return gr.MakePNGView(writer, index, nil)
+}
+
+// Generate a PNG result (single frame) of a viewport; nil is the grid.
+func (gr *GameRun) MakePNGView(writer io.Writer, index int, view *Viewport) (err error) {
+	if index < 0 {
+		err = BadIndexError
+		return
+	}
+	frames := gr.frames(index + 1)
+	if len(frames) <= index {
+		err = BadIndexError
+		return
+	}
+	if view == nil || view.Mode != ObjectView {
+		frames = frames[index:] // only objects are followed from the start
+	}
+	windows := view.windows(gr, frames)
+	grid := windows[len(windows)-1]
+	if index > 0 {
 		index--
-		if index < 0 || index >= len(gr.Cycles) {
-			err = BadIndexError
-			return
-		}
-		grid = gr.Cycles[index].AfterGrid
 	}
 	mag := magFactorFlag
-	rect := image.Rect(0, 0, mag*gr.Width+1, mag*gr.Height+1)
+	rect := image.Rect(0, 0, mag*grid.Width+1, mag*grid.Height+1)
 	img := image.NewPaletted(rect, paletteBW)
 	gr.FillImage(grid, img)
 	b, err := gr.encodePNGImage(img)
@@ -100,7 +411,7 @@ func (gr *GameRun) MakePNG(writer io.Writer, index int) (err error) {
 	count, err := writer.Write(b.Bytes())
 	log.Printf("Returned PNG, size= %d\n", count)
 	if saveImageFlag {
-		saveFile := fmt.Sprintf("/temp/Image_%s_%d.png", gr.Name, index)
+		saveFile := filepath.Join(saveDirFlag, fmt.Sprintf("Image_%s_%d.png", gr.Name, index))
 		xerr := ioutil.WriteFile(saveFile, b.Bytes(), os.ModePerm)
 		fmt.Printf("Save %s: %v\n", saveFile, xerr)
 	}
@@ -117,29 +428,29 @@ func (gr *GameRun) encodePNGImage(img *image.Paletted) (b bytes.Buffer, err erro
 
 // Generate a GIF result (>= 1 frame).
 func (gr *GameRun) MakeGIFs(count int) (agif *gif.GIF, err error) {
+	return gr.MakeGIFsView(count, nil)
+}
+
+// Generate a GIF result (>= 1 frame) of a viewport; nil is the grid.
+func (gr *GameRun) MakeGIFsView(count int, view *Viewport) (agif *gif.GIF, err error) {
 	mag := magFactorFlag
-	cycles := len(gr.Cycles)
-	xcount := cycles + 1
-	if xcount > count {
-		xcount = count
-	}
-	added := 0
 	agif = &gif.GIF{LoopCount: 5}
+	for _, grid := range view.windows(gr, gr.frames(count)) {
+		rect := image.Rect(0, 0, mag*grid.Width+1, mag*grid.Height+1)
+		gr.AddGrid(grid, image.NewPaletted(rect, paletteBW), agif)
+	}
+	return
+}
 
-	rect := image.Rect(0, 0, mag*gr.Width+1, mag*gr.Height+1)
-	img := image.NewPaletted(rect, paletteBW)
-	if added < xcount {
-		gr.AddGrid(gr.InitialGrid, img, agif)
-		added++
-	}
-	for i := 0; i < cycles; i++ {
-		if added < xcount {
-			img = image.NewPaletted(rect, paletteBW)
-			gc := gr.Cycles[i]
-			grid := gc.AfterGrid
-			gr.AddGrid(grid, img, agif)
-			added++
-		}
+// Get up to count grids: the initial grid then each cycle's.
+func (gr *GameRun) frames(count int) (grids []*Grid) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	if count > 0 {
+		grids = append(grids, gr.InitialGrid)
+	}
+	for i := 0; i < len(gr.Cycles) && len(grids) < count; i++ {
+		grids = append(grids, gr.Cycles[i].AfterGrid)
 	}
 	return
 }
@@ -163,7 +474,7 @@ func (gr *GameRun) FillImage(grid *Grid, img *image.Paletted) {
 			// apply magnification
 			for i := 0; i < mag; i++ {
 				for j := 0; j < mag; j++ {
-					img.SetColorIndex(mag*row+i, mag*col+j, uint8(index))
+					img.SetColorIndex(mag*col+j, mag*row+i, uint8(index))
 				}
 			}
 		}
@@ -180,35 +491,46 @@ var (
 )
 
 // Start a new game run.
+// The initial grid is loaded from an image or pattern, or is a random soup.
 func NewGameRun(name, url string, parent *Game) (gr *GameRun, err error) {
-	gr = &GameRun{}
-	gr.Parent = parent
-	gr.Name = name
-	gr.GoroutineCount = CoreGame.GoroutineCount
-	gr.ImageURL = url
-	gr.DelayIn10ms = 5 * 100
-	var img image.Image
-	var kind string
-	img, kind, err = LoadImage(url)
+	var soup *Soup
+	if strings.HasPrefix(url, RandomPrefix) {
+		if soup, err = ParseSoup(url); err != nil {
+			return
+		}
+		url = soup.String() // record the seed used
+	}
+	grid, kind, err := LoadSeed(url)
 	if err != nil {
 		return
 	}
-	fmt.Printf("Image kind:  %v\n", kind)
-	if kind != "png" {
-		return nil, NotPNGError
+	if !parent.Quiet {
+		fmt.Printf("Image kind:  %v\n", kind)
 	}
-	bounds := img.Bounds()
-	minX, minY, maxX, maxY := bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Max.Y
-	size := bounds.Size()
-	//xsize := size.X * size.Y
-	gr.InitialGrid = NewEmptyGrid(size.X, size.Y)
+	gr = NewGameRunFromGrid(name, url, grid, parent)
+	gr.Soup = soup
+	return
+}
+
+// Start a new game run from an initial grid.
+func NewGameRunFromGrid(name, source string, grid *Grid, parent *Game) (gr *GameRun) {
+	gr = &GameRun{}
+	gr.Parent = parent
+	gr.Name = name
+	parent.lock.Lock()
+	gr.GoroutineCount = parent.GoroutineCount
+	gr.AutoTune = parent.AutoTune
+	gr.MaxCycles = parent.MaxCycles
+	parent.lock.Unlock()
+	gr.Rule = ConwayRule
+	gr.Kernel = DefaultKernelName
+	gr.Topology = DefaultTopology
+	gr.Priority = NormalPriority
+	gr.ImageURL = source
+	gr.DelayIn10ms = DefaultDelayIn10ms
+	gr.InitialGrid = grid
 	gr.Width = gr.InitialGrid.Width
 	gr.Height = gr.InitialGrid.Height
-
-	err = gr.InitGridFromImage(minX, maxX, minY, maxY, img)
-	if err != nil {
-		return
-	}
 	gr.CurrentGrid = gr.InitialGrid.DeepCloneGrid()
 	return
 }
@@ -247,28 +569,50 @@ func (gr *GameRun) InitGridFromImage(minX, maxX, minY, maxY int,
 // Play a game.
 // Run requested cycle count.
 func (gr *GameRun) Run() (err error) {
+	gr.lock.Lock()
 	gr.StartedAt = time.Now()
-	for count := 0; count < gr.Parent.MaxCycles; count++ {
+	gr.lock.Unlock()
+	count := 0
+	if gr.AutoTune {
+		if count, err = gr.tune(); err != nil {
+			return
+		}
+	}
+	for ; count < gr.MaxCycles; count++ {
 		err = gr.NextCycle()
 		if err != nil {
 			return
 		}
 	}
+	gr.lock.Lock()
 	gr.EndedAt = time.Now()
-	fmt.Printf("GameRun total time: %dms, goroutine count: %d\n",
-		(gr.EndedAt.Sub(gr.StartedAt)+NanosPerMs)/NanosPerMs, gr.GoroutineCount)
 	gr.FinalGrid = gr.CurrentGrid.DeepCloneGrid()
+	gr.lock.Unlock()
+	runSeconds.Observe(gr.EndedAt.Sub(gr.StartedAt).Seconds(), strconv.Itoa(gr.GoroutineCount))
+	if !gr.Parent.Quiet {
+		fmt.Printf("GameRun total time: %dms, goroutine count: %d\n",
+			(gr.EndedAt.Sub(gr.StartedAt)+NanosPerMs)/NanosPerMs, gr.GoroutineCount)
+	}
 	return
 }
 
 // Represents a single cycle of a game.
 type GameCycle struct {
-	Parent     *GameRun
-	Cycle      int
-	StartedAt  time.Time
-	EndedAt    time.Time
-	BeforeGrid *Grid
-	AfterGrid  *Grid
+	Parent      *GameRun
+	Cycle       int
+	StartedAt   time.Time
+	EndedAt     time.Time
+	BeforeGrid  *Grid
+	AfterGrid   *Grid
+	Checksum    uint64 // of AfterGrid
+	Population  int    // of AfterGrid
+	Goroutines  int    // used to compute the cycle
+	MaxCycles   int    // of the run when played
+	TileSize    int    // cells across a tile (see tiles.go)
+	Tiles       int    // of the grid
+	ActiveTiles int    // recomputed; all but for the tiles kernel
+	active      []bool // tiles to recompute, while played
+	changed     []bool // by row and tile column, while played
 }
 
 func NewGameCycle(parent *GameRun) (gc *GameCycle) {
@@ -279,29 +623,77 @@ func NewGameCycle(parent *GameRun) (gc *GameCycle) {
 
 // Advance and play next game cycle.
 // Updating of cycle grid rows can be done in parallel;
-// which can reduce execution time.
+// which can reduce execution time. Only the run's player calls it; the
+// cycle is added under the run lock. A run without history plays into its
+// spare grid and keeps neither the cycle nor copies of its grids.
 func (gr *GameRun) NextCycle() (err error) {
 	gc := NewGameCycle(gr)
-	gc.BeforeGrid = gr.CurrentGrid.DeepCloneGrid()
-	p := gc.Parent
-	goroutineCount := p.Parent.GoroutineCount
+	if gr.noHistory {
+		gc.BeforeGrid = gr.CurrentGrid
+	} else {
+		gc.BeforeGrid = gr.CurrentGrid.DeepCloneGrid()
+	}
+	goroutineCount := gr.GoroutineCount
+	if gr.granted > 0 && gr.granted < goroutineCount {
+		goroutineCount = gr.granted
+	}
 	if goroutineCount <= 0 {
 		goroutineCount = 1
 	}
-	gc.AfterGrid = NewEmptyGrid(gc.BeforeGrid.Width, gc.BeforeGrid.Height)
+	if gr.Topology == UnboundedTopology {
+		if grown := gc.BeforeGrid.grown(); grown != gc.BeforeGrid {
+			gc.BeforeGrid, gr.tiles = grown, nil // every tile moved
+		}
+	}
+	width, height := gc.BeforeGrid.Width, gc.BeforeGrid.Height
+	if spare := gr.spare; gr.noHistory && spare != nil &&
+		spare.Width == width && spare.Height == height {
+		gc.AfterGrid = spare // kernels set every cell
+	} else {
+		gc.AfterGrid = NewEmptyGrid(width, height)
+	}
+	gc.AfterGrid.X, gc.AfterGrid.Y = gc.BeforeGrid.X, gc.BeforeGrid.Y
 	gc.StartedAt = time.Now()
-	// process rows across  allowed goroutines
-	rowCount := (gr.Height + goroutineCount/2) / goroutineCount
+	kernel, ok := Kernels[gr.Kernel]
+	if !ok {
+		err = fmt.Errorf("%w: %q", UnknownKernelError, gr.Kernel)
+		return
+	}
+	gc.TileSize = gr.tileSize()
+	tilesX, tilesY := tileCounts(width, height, gc.TileSize)
+	gc.Tiles, gc.ActiveTiles = tilesX*tilesY, tilesX*tilesY
+	sparse := gr.Kernel == TilesKernelName
+	if sparse {
+		gr.prepareTiles(gc)
+	}
+	// process rows across  allowed goroutines; every row must be covered
+	rowCount := (height + goroutineCount - 1) / goroutineCount
 	var wg sync.WaitGroup
-	for i := 0; i < goroutineCount; i++ {
+	for i := 0; i < goroutineCount && i*rowCount < height; i++ {
 		wg.Add(1)
-		go processRows(&wg, gc, rowCount, i*rowCount, gc.BeforeGrid, gc.AfterGrid)
+		go kernel(&wg, gc, rowCount, i*rowCount, gc.BeforeGrid, gc.AfterGrid)
 	}
 	wg.Wait() // let all finish
 	gc.EndedAt = time.Now()
-	gr.CurrentGrid = gc.AfterGrid.DeepCloneGrid()
-	gr.Cycles = append(gr.Cycles, gc)
-	gc.Cycle = len(gr.Cycles)
+	cycleSeconds.Observe(gc.EndedAt.Sub(gc.StartedAt).Seconds(), strconv.Itoa(goroutineCount))
+	gc.Goroutines, gc.MaxCycles = goroutineCount, gr.MaxCycles
+	if !gr.noHistory {
+		gc.Checksum = gc.AfterGrid.Checksum()
+		gc.Population = gridPopulation(gc.AfterGrid)
+	}
+	gr.lock.Lock()
+	gr.Width, gr.Height = width, height
+	if gr.noHistory {
+		gr.CurrentGrid, gr.spare = gc.AfterGrid, gc.BeforeGrid
+	} else {
+		gr.CurrentGrid = gc.AfterGrid.DeepCloneGrid()
+		gr.Cycles = append(gr.Cycles, gc)
+		gc.Cycle = len(gr.Cycles)
+	}
+	gr.lock.Unlock()
+	if sparse {
+		gr.finishTiles(gc)
+	}
 	return
 }
 
@@ -309,6 +701,7 @@ func (gr *GameRun) NextCycle() (err error) {
 type Grid struct {
 	Data          []byte
 	Width, Height int
+	X, Y          int // world coordinates of the top left cell (see topology.go)
 }
 
 func NewEmptyGrid(w, h int) (g *Grid) {
@@ -328,9 +721,35 @@ func (g *Grid) DeepCloneGrid() (c *Grid) {
 	}
 	c.Width = g.Width
 	c.Height = g.Height
+	c.X, c.Y = g.X, g.Y
 	return
 }
 
+var checksumTable = crc64.MakeTable(crc64.ECMA)
+
+// Get a stable checksum of a grid: CRC-64 (ECMA) of the width and height
+// (32 bit big endian) then the cells (one byte, 0 or 1, each) in row order.
+func (g *Grid) Checksum() uint64 {
+	var size [8]byte
+	binary.BigEndian.PutUint32(size[:4], uint32(g.Width))
+	binary.BigEndian.PutUint32(size[4:], uint32(g.Height))
+	crc := crc64.Update(0, checksumTable, size[:])
+	return crc64.Update(crc, checksumTable, g.Data)
+}
+
+// Count live cells.
+func gridPopulation(grid *Grid) (n int) {
+	for _, b := range grid.Data {
+		n += int(b)
+	}
+	return
+}
+
+// Format a checksum as returned to clients.
+func formatChecksum(checksum uint64) string {
+	return fmt.Sprintf("%016x", checksum)
+}
+
 func (g *Grid) getCell(x, y int) (b byte) {
 	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 		return
@@ -344,53 +763,113 @@ func (g *Grid) setCell(x, y int, b byte) {
 	g.Data[x+y*g.Width] = b
 }
 
+// Computes the next generation of a subset of grid rows.
+type Kernel func(wg *sync.WaitGroup, gc *GameCycle, rowCount int,
+	startRow int, inGrid, outGrid *Grid)
+
+// Default kernel name.
+const DefaultKernelName = "rows"
+
+// Available kernels by name.
+var Kernels = map[string]Kernel{
+	DefaultKernelName: processRows,
+	"direct":          processRowsDirect,
+	TilesKernelName:   processTiles,
+}
+
+var UnknownKernelError = errors.New("unknown kernel")
+
+// Get the kernel names in sorted order.
+func KernelNames() (names []string) {
+	for k := range Kernels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Play game as subset of grid rows (so can be done in parallel).
+// Indexes grid data directly instead of using getCell.
+func processRowsDirect(wg *sync.WaitGroup, gc *GameCycle, rowCount int,
+	startRow int, inGrid, outGrid *Grid) {
+	defer wg.Done()
+	rule := gc.Parent.Rule
+	torus := gc.Parent.Topology == TorusTopology
+	w, h := inGrid.Width, inGrid.Height
+	endRow := startRow + rowCount
+	if endRow > h {
+		endRow = h
+	}
+	for y := startRow; y < endRow; y++ {
+		for x := 0; x < w; x++ {
+			neighbors := 0
+			for ny := y - 1; ny <= y+1; ny++ {
+				wy := ny
+				if torus {
+					wy = (ny + h) % h
+				} else if ny < 0 || ny >= h {
+					continue
+				}
+				row := inGrid.Data[wy*w : wy*w+w]
+				for nx := x - 1; nx <= x+1; nx++ {
+					wx := nx
+					if torus {
+						wx = (nx + w) % w
+					} else if nx < 0 || nx >= w {
+						continue
+					}
+					if nx != x || ny != y {
+						neighbors += int(row[wx])
+					}
+				}
+			}
+			outGrid.Data[y*w+x] = rule.Next(inGrid.Data[y*w+x], neighbors)
+		}
+	}
+}
+
 // Play game as subset of grid rows (so can be done in parallel).
 func processRows(wg *sync.WaitGroup, gc *GameCycle, rowCount int,
 	startRow int, inGrid, outGrid *Grid) {
 	defer wg.Done()
 	gr := gc.Parent
+	getCell := inGrid.getCell
+	if gr.Topology == TorusTopology {
+		getCell = inGrid.getTorusCell
+	}
 	for index := 0; index < rowCount; index++ {
 		rowIndex := index + startRow
-		for colIndex := 0; colIndex < gr.Width; colIndex++ {
+		for colIndex := 0; colIndex < inGrid.Width; colIndex++ {
 			// count any neighbors
 			neighbors := 0
-			if inGrid.getCell(colIndex-1, rowIndex-1) != 0 {
+			if getCell(colIndex-1, rowIndex-1) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex, rowIndex-1) != 0 {
+			if getCell(colIndex, rowIndex-1) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex+1, rowIndex-1) != 0 {
+			if getCell(colIndex+1, rowIndex-1) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex-1, rowIndex) != 0 {
+			if getCell(colIndex-1, rowIndex) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex+1, rowIndex) != 0 {
+			if getCell(colIndex+1, rowIndex) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex-1, rowIndex+1) != 0 {
+			if getCell(colIndex-1, rowIndex+1) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex, rowIndex+1) != 0 {
+			if getCell(colIndex, rowIndex+1) != 0 {
 				neighbors++
 			}
-			if inGrid.getCell(colIndex+1, rowIndex+1) != 0 {
+			if getCell(colIndex+1, rowIndex+1) != 0 {
 				neighbors++
 			}
 
 			// determine next generation cell state based on neighbor count
-			pv := inGrid.getCell(colIndex, rowIndex)
-			nv := uint8(0) // assume dead
-			switch neighbors {
-			case 2:
-				nv = pv // unchanged
-			case 3:
-				if pv == 0 {
-					nv = 1 // make alive
-				}
-			}
-			outGrid.setCell(colIndex, rowIndex, nv)
+			pv := getCell(colIndex, rowIndex)
+			outGrid.setCell(colIndex, rowIndex, gr.Rule.Next(pv, neighbors))
 		}
 	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"hash/crc64"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	grid := NewEmptyGrid(3, 2)
+	grid.setCell(1, 0, 1)
+	grid.setCell(2, 1, 1)
+	// CRC-64 (ECMA) of the big endian width and height, then the cells
+	want := crc64.Checksum([]byte{0, 0, 0, 3, 0, 0, 0, 2, 0, 1, 0, 0, 0, 1},
+		crc64.MakeTable(crc64.ECMA))
+	if got := grid.Checksum(); got != want {
+		t.Errorf("got %016x, want %016x", got, want)
+	}
+	if got := formatChecksum(grid.Checksum()); len(got) != 16 {
+		t.Errorf("formatted checksum %q is not 16 hex digits", got)
+	}
+	moved := grid.DeepCloneGrid()
+	moved.X, moved.Y = 10, -10
+	if moved.Checksum() != grid.Checksum() {
+		t.Errorf("checksum depends on the grid origin")
+	}
+	if NewEmptyGrid(3, 2).Checksum() == NewEmptyGrid(2, 3).Checksum() {
+		t.Errorf("checksum does not depend on the grid size")
+	}
+}
+
+func TestNextCycleCoversEveryRow(t *testing.T) {
+	// A blinker in the last row is lost if rows are not all computed.
+	for _, n := range []int{1, 2, 3, 4, 5, 7} {
+		grid := NewEmptyGrid(5, 7)
+		for x := 1; x <= 3; x++ {
+			grid.setCell(x, 5, 1)
+		}
+		g := &Game{Runs: make(map[string]*GameRun), MaxCycles: 2, Quiet: true}
+		gr, err := g.RunGrid("blinker", "test", grid, RunParams{Goroutines: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := gr.CurrentGrid.Checksum(), grid.Checksum(); got != want {
+			t.Errorf("%d goroutines: blinker did not return after 2 cycles", n)
+		}
+	}
+}
+
+func TestUnboundedGliderEveryKernel(t *testing.T) {
+	// A glider crossing the edge of an unbounded grid grows it every few
+	// cycles; it dies if a kernel misses the new cells.
+	for _, kernel := range KernelNames() {
+		grid, err := ParseRLE("x = 3, y = 3\nbob$2bo$3o!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := &Game{Runs: make(map[string]*GameRun), MaxCycles: 40, Quiet: true}
+		gr, err := g.RunGrid("glider", "test", grid,
+			RunParams{Kernel: kernel, Topology: UnboundedTopology})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := gridPopulation(gr.CurrentGrid); got != 5 {
+			t.Errorf("%s: population %d after 40 cycles, want 5", kernel, got)
+		}
+		if gr.CurrentGrid.Width <= grid.Width || gr.CurrentGrid.Height <= grid.Height {
+			t.Errorf("%s: grid did not grow", kernel)
+		}
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 )
 
-
 // Command line flags.
 var (
 	urlFlag         string
@@ -18,7 +18,35 @@ var (
 	startServerFlag bool
 	runTimingsFlag  bool
 	reportFlag      bool
+	benchWarmFlag   int
+	benchRepsFlag   int
+	benchSizesFlag  string
+	benchGosFlag    string
+	benchKernsFlag  string
+	benchCSVFlag    string
+	benchJSONFlag   string
+	benchChartFlag  bool
 	saveImageFlag   bool
+	fileRootFlag    string
+	schemesFlag     string
+	hostsFlag       string
+	allowPrivFlag   bool
+	denyNetsFlag    string
+	maxLoadFlag     int64
+	loadTimeFlag    time.Duration
+	maxCyclesFlag   int
+	goroutinesFlag  int
+	autoTuneFlag    bool
+	saveDirFlag     string
+	printConfigFlag bool
+	maxRunsFlag     int
+	maxRunBytesFlag int64
+	maxRunAgeFlag   time.Duration
+	cycleLimitFlag  int
+	gorLimitFlag    int
+	delayLimitFlag  int
+	workerLimitFlag int
+	queueLimitFlag  int
 )
 
 // Command line help strings
@@ -28,9 +56,46 @@ const (
 	magFactorHelp = "magnify the grid by this factor when formatted into an image"
 	gridHelp      = "specify the layout grid (for PNG images); MxN, default 1x1"
 	startHelp     = "start the HTTP server (default true)"
-	timingHelp    = "run game cycle timings with different goroutine counts"
-	reportHelp    = "output run statistics"
+	timingHelp    = "benchmark game cycles with different goroutine counts, board sizes and kernels"
+	reportHelp    = "output each timed benchmark run"
+	benchWarmHelp = "untimed warm-up runs per benchmark configuration"
+	benchRepsHelp = "timed runs per benchmark configuration"
+	benchSizeHelp = "comma separated WxH benchmark board sizes; default is the -url image size"
+	benchGosHelp  = "comma separated benchmark goroutine counts (1 is always included)"
+	benchKernHelp = "comma separated benchmark kernels"
+	benchCSVHelp  = "write benchmark results to this CSV file"
+	benchJSONHelp = "write benchmark results to this JSON file"
+	benchChrtHelp = "print an ASCII chart of benchmark speedup"
 	saveImageHelp = "save generated images into a file"
+	fileRootHelp  = "directory \"file:\" URLs must be under; empty (the server default) disables files"
+	schemesHelp   = "comma separated URL schemes allowed for images"
+	hostsHelp     = "comma separated hosts allowed for images (*.domain allowed); empty allows any"
+	allowPrivHelp = "allow images from loopback and private network addresses"
+	denyNetsHelp  = "comma separated CIDR ranges images cannot come from"
+	maxLoadHelp   = "maximum image download size in bytes"
+	loadTimeHelp  = "maximum image download time"
+	addrHelp      = "HTTP server listen address"
+	readTimeHelp  = "HTTP server request read timeout"
+	writeTimeHelp = "HTTP server response write timeout (includes run time)"
+	idleTimeHelp  = "HTTP server keep-alive idle timeout"
+	stopTimeHelp  = "time allowed to drain in-flight requests and runs on shutdown"
+	certHelp      = "TLS certificate file; serve HTTPS if set with -key"
+	keyHelp       = "TLS private key file; serve HTTPS if set with -cert"
+	maxCycleHelp  = "number of cycles (generations) per run"
+	gosHelp       = "number of goroutines used to compute each cycle"
+	autoTuneHelp  = "pick the goroutines (and tile size) of runs not setting goroutines by calibration"
+	saveDirHelp   = "directory saved images are written to"
+	configHelp    = "configuration file (.json, .yaml or .toml); also GOL_CONFIG"
+	printCfgHelp  = "print the effective configuration and exit"
+	authFileHelp  = "users file (JSON) with API key hashes and quotas; empty disables authentication"
+	maxRunsHelp   = "maximum runs held (per user); least recently viewed are evicted; 0 is unlimited"
+	maxRunByHelp  = "maximum bytes of grids held by runs (per user); 0 is unlimited"
+	maxRunAgeHelp = "evict runs this long after they started; 0 keeps them"
+	cycleLimHelp  = "maximum cycles a run can request (including continues)"
+	gorLimitHelp  = "maximum goroutines a run can request"
+	delayLimHelp  = "maximum GIF frame delay (10ms units) a run can request"
+	workerLimHelp = "maximum worker goroutines shared by the server's running runs"
+	queueLimHelp  = "maximum runs waiting to start on the server"
 )
 
 // Define command line flags.
@@ -46,22 +111,89 @@ func init() {
 	flag.IntVar(&magFactorFlag, "mag", 1, magFactorHelp)
 	flag.BoolVar(&startServerFlag, "start", true, startHelp)
 	flag.BoolVar(&runTimingsFlag, "time", false, timingHelp)
+	flag.BoolVar(&runTimingsFlag, "bench", false, timingHelp)
 	flag.BoolVar(&reportFlag, "report", false, reportHelp)
+	flag.IntVar(&benchWarmFlag, "benchWarmup", 2, benchWarmHelp)
+	flag.IntVar(&benchRepsFlag, "benchReps", 10, benchRepsHelp)
+	flag.StringVar(&benchSizesFlag, "benchSizes", "", benchSizeHelp)
+	flag.StringVar(&benchGosFlag, "benchGoroutines", "1,2,4,8,16,32,64", benchGosHelp)
+	flag.StringVar(&benchKernsFlag, "benchKernels", strings.Join(KernelNames(), ","), benchKernHelp)
+	flag.StringVar(&benchCSVFlag, "benchCSV", "", benchCSVHelp)
+	flag.StringVar(&benchJSONFlag, "benchJSON", "", benchJSONHelp)
+	flag.BoolVar(&benchChartFlag, "benchChart", false, benchChrtHelp)
 	flag.BoolVar(&saveImageFlag, "saveImage", false, saveImageHelp)
 	flag.BoolVar(&saveImageFlag, "si", false, saveImageHelp)
+	flag.StringVar(&fileRootFlag, "fileRoot", CurrentPolicy.FileRoot, fileRootHelp)
+	flag.StringVar(&schemesFlag, "allowSchemes",
+		strings.Join(CurrentPolicy.AllowedSchemes, ","), schemesHelp)
+	flag.StringVar(&hostsFlag, "allowHosts", "", hostsHelp)
+	flag.BoolVar(&allowPrivFlag, "allowPrivate", false, allowPrivHelp)
+	flag.StringVar(&denyNetsFlag, "denyNets", "", denyNetsHelp)
+	flag.Int64Var(&maxLoadFlag, "maxDownload", CurrentPolicy.MaxBytes, maxLoadHelp)
+	flag.DurationVar(&loadTimeFlag, "loadTimeout", CurrentPolicy.Timeout, loadTimeHelp)
+	flag.StringVar(&spec, "addr", spec, addrHelp)
+	flag.DurationVar(&readTimeout, "readTimeout", readTimeout, readTimeHelp)
+	flag.DurationVar(&writeTimeout, "writeTimeout", writeTimeout, writeTimeHelp)
+	flag.DurationVar(&idleTimeout, "idleTimeout", idleTimeout, idleTimeHelp)
+	flag.DurationVar(&shutdownTimeout, "shutdownTimeout", shutdownTimeout, stopTimeHelp)
+	flag.StringVar(&certFile, "cert", "", certHelp)
+	flag.StringVar(&keyFile, "key", "", keyHelp)
+	flag.IntVar(&maxCyclesFlag, "maxCycles", CoreGame.MaxCycles, maxCycleHelp)
+	flag.IntVar(&goroutinesFlag, "goroutines", CoreGame.GoroutineCount, gosHelp)
+	flag.BoolVar(&autoTuneFlag, "autoTune", false, autoTuneHelp)
+	flag.StringVar(&saveDirFlag, "saveDir", "/temp", saveDirHelp)
+	flag.StringVar(&authFileFlag, "authFile", "", authFileHelp)
+	flag.IntVar(&maxRunsFlag, "maxRuns", 0, maxRunsHelp)
+	flag.Int64Var(&maxRunBytesFlag, "maxRunBytes", 0, maxRunByHelp)
+	flag.DurationVar(&maxRunAgeFlag, "maxRunAge", 0, maxRunAgeHelp)
+	flag.IntVar(&cycleLimitFlag, "cycleLimit", CurrentLimits.MaxCycles, cycleLimHelp)
+	flag.IntVar(&gorLimitFlag, "goroutineLimit", CurrentLimits.MaxGoroutines, gorLimitHelp)
+	flag.IntVar(&delayLimitFlag, "delayLimit", CurrentLimits.MaxDelay, delayLimHelp)
+	flag.IntVar(&workerLimitFlag, "workerLimit", runtime.NumCPU(), workerLimHelp)
+	flag.IntVar(&queueLimitFlag, "queueLimit", 100, queueLimHelp)
+	flag.StringVar(&configFile, "config", "", configHelp)
+	flag.BoolVar(&printConfigFlag, "print-config", false, printCfgHelp)
+}
+
+// Set the image load policy from the flags.
+func setLoadPolicy() (err error) {
+	nets, err := ParseNets(denyNetsFlag)
+	if err != nil {
+		return
+	}
+	if maxLoadFlag < 1 || loadTimeFlag <= 0 {
+		return fmt.Errorf("maxDownload and loadTimeout must be positive")
+	}
+	CurrentPolicy = &LoadPolicy{
+		FileRoot:       fileRootFlag,
+		AllowedSchemes: splitList(schemesFlag),
+		AllowedHosts:   splitList(hostsFlag),
+		DenyPrivate:    !allowPrivFlag,
+		DeniedNets:     nets,
+		MaxBytes:       maxLoadFlag,
+		Timeout:        loadTimeFlag,
+		MaxRedirects:   CurrentPolicy.MaxRedirects,
+	}
+	return
 }
 
 const golDescription = `
 Play the game of Life.
+Commands (run, render, serve, bench, convert) are preferred; see "gol help".
 Game boards are initialized from PNG images.
+Settings can also come from a config file (-config) and GOL_* environment
+variables (ex. GOL_MAX_CYCLES); flags take precedence.
 Games play over cycles.
 Optionally acts as a server to retrieve images of game boards during play.
 No supported positional arguments. Supported flags (some have short forms):
 `
 
 // Main entry point.
-// Sample: -n bart -u file:/Users/Administrator/Downloads/bart.png
+// Sample: -n bart -u file:/Users/Administrator/Downloads/bart.png -fileRoot /Users
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(RunCommand(os.Args[1], os.Args[2:]))
+	}
 	if len(os.Args) <= 1 {
 		fmt.Fprintln(os.Stderr, strings.TrimSpace(golDescription))
 		flag.PrintDefaults()
@@ -75,18 +207,24 @@ func main() {
 			"positional command arguments (%v) not accepted\n", flag.Args()))
 		os.Exit(1)
 	}
+	if err := LoadConfig(flag.CommandLine); err != nil {
+		fatalIfError(fmt.Fprintf(os.Stderr, "bad configuration: %v\n", err))
+		os.Exit(1)
+	}
+	if printConfigFlag {
+		fatalIfError(PrintConfig())
+		os.Exit(0)
+	}
 	launch()
 }
 
 func launch() {
-	if len(urlFlag) > 0 {
-		if len(nameFlag) == 0 {
-			fatalIfError(fmt.Fprintln(os.Stderr,
-				"a name is required when a URL is provided"))
-		}
-		if runTimingsFlag {
-			runCycleTimings()
-		}
+	if len(urlFlag) > 0 && len(nameFlag) == 0 && !runTimingsFlag {
+		fatalIfError(fmt.Fprintln(os.Stderr,
+			"a name is required when a URL is provided"))
+	}
+	if runTimingsFlag {
+		runBenchmarks()
 	}
 
 	if startServerFlag {
@@ -104,31 +242,53 @@ func startHTTPServer() {
 
 }
 
-// Output information about recorded cycles.
-func runCycleTimings() {
-	cpuCount := runtime.NumCPU()
-	for i := 1; i <= 64; i *= 2 {
-		fmt.Printf("Running with %d goroutines, %d CPUs...\n", i, cpuCount)
-		CoreGame.GoroutineCount = i
-		err := CoreGame.Run(nameFlag, urlFlag)
-		if err != nil {
-			fmt.Printf("Program failed: %v\n", err)
-			os.Exit(2)
+// Run benchmarks as configured by the flags and output the results.
+func runBenchmarks() {
+	bc := &BenchConfig{Warmup: benchWarmFlag, Reps: benchRepsFlag,
+		Cycles: CoreGame.MaxCycles, Report: reportFlag, Out: os.Stdout}
+	var err error
+	fail := func(format string, args ...interface{}) {
+		fatalIfError(fmt.Fprintf(os.Stderr, format+"\n", args...))
+		os.Exit(2)
+	}
+	if bc.Warmup < 0 || bc.Reps < 1 {
+		fail("benchWarmup must be >= 0 and benchReps >= 1")
+	}
+	if bc.Sizes, err = ParseSizes(benchSizesFlag); err != nil {
+		fail("bad benchSizes: %v", err)
+	}
+	if bc.Goroutines, err = ParseInts(benchGosFlag); err != nil {
+		fail("bad benchGoroutines: %v", err)
+	}
+	bc.Kernels = splitList(benchKernsFlag)
+	for _, k := range bc.Kernels {
+		if _, ok := Kernels[k]; !ok {
+			fail("unknown kernel %q; known: %v", k, KernelNames())
+		}
+	}
+	if len(urlFlag) > 0 {
+		if bc.Seed, _, err = LoadSeed(urlFlag); err != nil {
+			fail("cannot load %s: %v", urlFlag, err)
 		}
-		if reportFlag {
-			fmt.Printf("Game max: %d, go count: %d:\n",
-				CoreGame.MaxCycles, CoreGame.GoroutineCount)
-			for _, gr := range CoreGame.Runs {
-				fmt.Printf("Game Run: %v, cycle count: %d\n", gr.Name, len(gr.Cycles))
-				for _, c := range gr.Cycles {
-					start, end :=
-						c.StartedAt.UnixNano()/NanosPerMs,
-						c.EndedAt.UnixNano()/NanosPerMs
-					fmt.Printf(
-						"Cycle: start epoch: %dms, end epoch: %dms, elapsed: %dms\n",
-						start, end, end-start)
-				}
-			}
+	} else if len(bc.Sizes) == 0 {
+		fail("benchmarks need -url or -benchSizes")
+	}
+	results, err := RunBenchmarks(bc)
+	if err != nil {
+		fail("benchmark failed: %v", err)
+	}
+	PrintBenchTable(os.Stdout, results)
+	if benchChartFlag {
+		PrintBenchChart(os.Stdout, results, 20)
+	}
+	if len(benchCSVFlag) > 0 {
+		if err = writeBenchFile(benchCSVFlag, WriteBenchCSV, results); err != nil {
+			fail("cannot write %s: %v", benchCSVFlag, err)
+		}
+	}
+	if len(benchJSONFlag) > 0 {
+		if err = writeBenchFile(benchJSONFlag, WriteBenchJSON, results); err != nil {
+			fail("cannot write %s: %v", benchJSONFlag, err)
 		}
 	}
 }
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics in the Prometheus text exposition format (version 0.0.4).
+// See https://prometheus.io/docs/instrumenting/exposition_formats/.
+
+// A metric family that can write its samples.
+type metric interface {
+	write(w io.Writer)
+}
+
+// A set of metric families, written in registration order.
+type Registry struct {
+	lock    sync.Mutex
+	metrics []metric
+}
+
+func (r *Registry) register(m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write all metrics.
+func (r *Registry) Write(w io.Writer) (err error) {
+	r.lock.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.lock.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err = bw.Flush()
+	return
+}
+
+// Common parts of a metric family.
+type family struct {
+	name, help, kind string
+	labelNames       []string
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// Make the key for a set of label values.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s: want %d label values, got %d",
+			f.name, len(f.labelNames), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Format labels (plus any extra name/value pair) as {a="x",b="y"}.
+func (f *family) labels(key string, extra ...string) string {
+	var parts []string
+	if len(f.labelNames) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			parts = append(parts, fmt.Sprintf(`%s="%s"`, f.labelNames[i], escapeLabel(v)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Escapes in label values: the format allows only these.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Escape a label value.
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// A monotonically increasing count per label set.
+type Counter struct {
+	family
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+func NewCounter(r *Registry, name, help string, labelNames ...string) (c *Counter) {
+	c = &Counter{family: family{name, help, "counter", labelNames},
+		values: make(map[string]float64)}
+	r.register(c)
+	return
+}
+
+// Add one for the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add a non-negative amount for the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[key] += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.writeHeader(w)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(key), formatValue(c.values[key]))
+	}
+}
+
+// A value computed when metrics are written.
+type GaugeFunc struct {
+	family
+	f func() float64
+}
+
+func NewGaugeFunc(r *Registry, name, help string, f func() float64) (g *GaugeFunc) {
+	g = &GaugeFunc{family: family{name: name, help: help, kind: "gauge"}, f: f}
+	r.register(g)
+	return
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.f()))
+}
+
+// Counts of observations in buckets per label set.
+type Histogram struct {
+	family
+	buckets []float64 // upper bounds, ascending; +Inf implied
+	lock    sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket (not cumulative)
+	sum    float64
+	count  uint64
+}
+
+func NewHistogram(r *Registry, name, help string, buckets []float64,
+	labelNames ...string) (h *Histogram) {
+	h = &Histogram{family: family{name, help, "histogram", labelNames},
+		buckets: buckets, values: make(map[string]*histogramValue)}
+	r.register(h)
+	return
+}
+
+// Record an observation for the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.writeHeader(w)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hv := h.values[key]
+		cumulative := uint64(0)
+		for i, le := range h.buckets {
+			cumulative += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", formatValue(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(key), formatValue(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(key), hv.count)
+	}
+}
+
+// Make n bucket bounds starting at start, each factor times the last.
+func ExponentialBuckets(start, factor float64, n int) (buckets []float64) {
+	for i := 0; i < n; i++ {
+		buckets = append(buckets, start)
+		start *= factor
+	}
+	return
+}
+
+// GoL server metrics.
+var (
+	Metrics = &Registry{}
+
+	runsStarted = NewCounter(Metrics, "gol_runs_started_total",
+		"Runs admitted (queued or playing, then completed or failed).", "endpoint")
+	runsCompleted = NewCounter(Metrics, "gol_runs_completed_total",
+		"Runs completed successfully.", "endpoint")
+	runsFailed = NewCounter(Metrics, "gol_runs_failed_total",
+		"Runs that failed (including rejected seeds).", "endpoint")
+	cycleSeconds = NewHistogram(Metrics, "gol_cycle_duration_seconds",
+		"Time to compute one cycle (generation).",
+		ExponentialBuckets(0.0001, 4, 10), "goroutines")
+	runSeconds = NewHistogram(Metrics, "gol_run_duration_seconds",
+		"Time to compute all cycles of a run.",
+		ExponentialBuckets(0.001, 4, 10), "goroutines")
+	_ = NewGaugeFunc(Metrics, "gol_runs_in_memory",
+		"Runs held in memory.", func() float64 {
+			n := 0
+			for _, g := range allGames() {
+				n += len(g.RunNames())
+			}
+			return float64(n)
+		})
+	_ = NewGaugeFunc(Metrics, "gol_run_grid_bytes",
+		"Total bytes of grids held by runs in memory.", func() float64 {
+			var n int64
+			for _, g := range allGames() {
+				n += g.GridBytes()
+			}
+			return float64(n)
+		})
+	runsEvicted = NewCounter(Metrics, "gol_runs_evicted_total",
+		"Runs evicted by retention limits.", "reason")
+	queueSeconds = NewHistogram(Metrics, "gol_run_queue_wait_seconds",
+		"Time runs wait in the run queue.",
+		ExponentialBuckets(0.001, 4, 10))
+	_ = NewGaugeFunc(Metrics, "gol_run_queue_length",
+		"Runs waiting in the run queue.", func() float64 {
+			if s := RunScheduler; s != nil {
+				queued, _ := s.Load()
+				return float64(queued)
+			}
+			return 0
+		})
+	_ = NewGaugeFunc(Metrics, "gol_run_worker_goroutines",
+		"Worker goroutines granted to running runs.", func() float64 {
+			if s := RunScheduler; s != nil {
+				_, busy := s.Load()
+				return float64(busy)
+			}
+			return 0
+		})
+	httpRequests = NewCounter(Metrics, "gol_http_requests_total",
+		"HTTP requests by handler path, method and status code.",
+		"path", "method", "code")
+	httpSeconds = NewHistogram(Metrics, "gol_http_request_duration_seconds",
+		"HTTP request latency by handler path and method.",
+		ExponentialBuckets(0.001, 4, 10), "path", "method")
+)
+
+// Record the outcome of an attempt to create a run; runs are counted as
+// started when admitted.
+func observeRunOutcome(endpoint string, err error) {
+	if err != nil {
+		runsFailed.Inc(endpoint)
+		return
+	}
+	runsCompleted.Inc(endpoint)
+}
+
+// Metrics request handler.
+func metricsHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.Header().Set("Allow", "GET")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Metrics.Write(writer) // error ignored
+}
+
+// Records the status code sent by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = 200
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Wrap a handler to record HTTP metrics; path is the registered path
+// (not the request path) to bound the label values.
+func MetricsWrapper(path string, f http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: writer}
+		f(sr, request)
+		if sr.status == 0 {
+			sr.status = 200
+		}
+		method := request.Method
+		if !metricMethods[method] {
+			method = "other"
+		}
+		httpSeconds.Observe(time.Since(start).Seconds(), path, method)
+		httpRequests.Inc(path, method, strconv.Itoa(sr.status))
+	}
+}
+
+// Methods used as label values; clients choose the method, so others are
+// "other" to bound the label sets.
+var metricMethods = map[string]bool{"GET": true, "POST": true, "PUT": true,
+	"PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLabelEscaping(t *testing.T) {
+	r := &Registry{}
+	c := NewCounter(r, "test_total", "Test.", "v")
+	c.Inc("a\\b\"c\nd\té")
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "test_total{v=\"a\\\\b\\\"c\\nd\té\"} 1\n"
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want it to end %q", got, want)
+	}
+}
+
+func TestMetricsMethodLabel(t *testing.T) {
+	f := MetricsWrapper("/test-methods", func(writer http.ResponseWriter, request *http.Request) {})
+	for _, method := range []string{"GET", "BREW", "PURGE"} {
+		f(httptest.NewRecorder(), httptest.NewRequest(method, "/test-methods", nil))
+	}
+	var buf bytes.Buffer
+	if err := Metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, want := range []string{`path="/test-methods",method="GET",code="200"} 1`,
+		`path="/test-methods",method="other",code="200"} 2`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+	if strings.Contains(text, "BREW") {
+		t.Errorf("client method used as a label value")
+	}
+}
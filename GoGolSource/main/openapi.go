@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OpenAPI 3 description of the HTTP API, served at /openapi.json.
+// Schemas are generated from the X* types (by reflection, from their JSON
+// tags); operations are listed in apiOperations. RegisterDefaultContexts
+// checks every registered path is described (see checkOpenAPI).
+
+const openAPIVersion = "3.0.3"
+
+// API version, reported in the OpenAPI document.
+const APIVersion = "1.0.0"
+
+// Text media types.
+const (
+	htmlType  = "text/html"
+	textType  = "text/plain"
+	formType  = "multipart/form-data"
+	octetType = "application/octet-stream"
+)
+
+// A parameter of an operation.
+type apiParam struct {
+	name, in, kind, description string // kind is a JSON schema type
+	required                    bool
+}
+
+// An operation (method on a path) of the API.
+type apiOperation struct {
+	method, path, summary string
+	params                []apiParam
+	request               interface{} // body (a value of an X type); nil if none
+	requestTypes          []string
+	status                int         // success status
+	response              interface{} // body (a value of an X type); nil if none
+	responseTypes         []string
+}
+
+// Query parameter shorthand.
+func queryParam(name, kind, description string) apiParam {
+	return apiParam{name: name, in: "query", kind: kind, description: description}
+}
+
+// Required parameter shorthand.
+func requiredParam(p apiParam) apiParam {
+	p.required = true
+	return p
+}
+
+// Path parameter shorthand.
+func pathParam(name, kind, description string) apiParam {
+	return apiParam{name: name, in: "path", kind: kind, description: description, required: true}
+}
+
+// The operations of the API.
+var apiOperations = func() []*apiOperation {
+	structured := []string{jsonType, xmlType}
+	runName := pathParam("name", "string", "run name")
+	paging := []apiParam{queryParam("offset", "integer", "runs to skip"),
+		queryParam("limit", "integer", "maximum runs returned (1 to 500, default 50)"),
+		queryParam("prefix", "string", "only runs with names starting with this"),
+		queryParam("source", "string", "only runs with sources containing this"),
+		queryParam("rule", "string", "only runs with this rule")}
+	runBody := []string{jsonType, formType, octetType}
+	playParams := []apiParam{queryParam("name", "string", "run name (required for GET)"),
+		queryParam("url", "string", "seed URL (required for GET)"),
+		queryParam("cycles", "integer", "cycles to play (default from the server)"),
+		queryParam("goroutines", "string",
+			"goroutines per cycle (default from the server), or auto to pick by calibration"),
+		queryParam("rule", "string", "rule (default B3/S23)"),
+		queryParam("kernel", "string", "kernel: rows (default), direct or tiles (recomputes only changed areas)"),
+		queryParam("topology", "string", "bounded (default), torus or unbounded (grows as needed)"),
+		queryParam("delay", "integer", "GIF frame delay in 10ms units (default 500)"),
+		queryParam("pinned", "boolean", "never evict the run"),
+		queryParam("priority", "string", "low, normal (default) or high (admins only)"),
+		queryParam("ct", "string", "response type, overriding Accept: application/json (default), "+
+			"application/xml, text/csv, application/yaml or application/x-ndjson")}
+	return []*apiOperation{
+		{method: "GET", path: "/play", summary: "play a run from a seed URL, replacing any run with the name",
+			params: playParams, status: 200, response: XGameRun{}, responseTypes: runTypes},
+		{method: "POST", path: "/play", summary: "play a run from an uploaded seed, replacing any run with the name",
+			params: playParams[2:], request: XRunRequest{}, requestTypes: runBody,
+			status: 200, response: XGameRun{}, responseTypes: runTypes},
+		{method: "GET", path: "/show", summary: "get an image of a run",
+			params: []apiParam{queryParam("name", "string", "run name (default \"default\")"),
+				queryParam("form", "string", "gif (default; animated) or png (one cycle)"),
+				queryParam("index", "integer", "cycle for png (default 0)"),
+				queryParam("maxCount", "integer", "maximum GIF frames (1 to 100, default 20)"),
+				queryParam("mag", "integer", "magnification (1 to 20)"),
+				queryParam("grid", "string", "tiling for png (only 1x1)"),
+				queryParam("view", "string", "viewport: fixed (default), bounds (follows the live cells) "+
+					"or object (follows the object nearest object=X,Y)"),
+				queryParam("x", "integer", "viewport left (world coordinates, fixed view; default centers the window)"),
+				queryParam("y", "integer", "viewport top (world coordinates, fixed view)"),
+				queryParam("w", "integer", "viewport width (default: every grid, at most 4096, or the seed's for following views)"),
+				queryParam("h", "integer", "viewport height"),
+				queryParam("object", "string", "X,Y of a cell of (or near) the object to follow")},
+			status: 200, responseTypes: []string{gifType, pngType}},
+		{method: "GET", path: "/history", summary: "get all (of the user's) runs and recent evictions",
+			status: 200, response: XGame{}, responseTypes: runTypes},
+		{method: "DELETE", path: "/history", summary: "delete all (of the user's) runs",
+			params: []apiParam{queryParam("all", "boolean", "delete every user's runs (admins only)"),
+				queryParam("user", "string", "delete this user's runs (admins only)")},
+			status: 204},
+		{method: "GET", path: "/account", summary: "get the user's quota and usage",
+			status: 200, response: XAccount{}, responseTypes: structured},
+		{method: "GET", path: "/runs", summary: "list runs", params: paging,
+			status: 200, response: XRunList{}, responseTypes: runTypes},
+		{method: "POST", path: "/runs", summary: "create (and play) a run",
+			request: XRunRequest{}, requestTypes: runBody,
+			status: 201, response: XGameRun{}, responseTypes: runTypes},
+		{method: "GET", path: "/runs/{name}", summary: "get a run", params: []apiParam{runName},
+			status: 200, response: XGameRun{}, responseTypes: runTypes},
+		{method: "DELETE", path: "/runs/{name}", summary: "delete a run", params: []apiParam{runName},
+			status: 204},
+		{method: "GET", path: "/runs/{name}/cycles/{n}", summary: "get a cycle; 0 is the initial grid",
+			params: []apiParam{runName, pathParam("n", "integer", "cycle")},
+			status: 200, response: XGameCycle{}, responseTypes: []string{jsonType, xmlType, pngType, rleType}},
+		{method: "GET", path: "/runs/{name}/board", summary: "get the current grid",
+			params: []apiParam{runName},
+			status: 200, response: XBoard{}, responseTypes: []string{jsonType, xmlType, pngType, rleType}},
+		{method: "POST", path: "/runs/{name}/edits", summary: "edit the current grid (one edit or a list); 409 while the run plays",
+			params: []apiParam{runName}, request: []*XEdit{}, requestTypes: structured,
+			status: 200, response: XBoard{}, responseTypes: structured},
+		{method: "POST", path: "/runs/{name}/continue", summary: "play more cycles; 409 while the run plays",
+			params: []apiParam{runName, queryParam("cycles", "integer", "cycles to play (default 1)")},
+			status: 200, response: XBoard{}, responseTypes: structured},
+		{method: "POST", path: "/runs/{name}/rewind", summary: "rewind to a cycle, discarding later ones; 409 while the run plays",
+			params: []apiParam{runName, requiredParam(queryParam("cycle", "integer", "cycle to rewind to"))},
+			status: 200, response: XBoard{}, responseTypes: structured},
+		{method: "POST", path: "/runs/{name}/fork", summary: "fork at a cycle into a new run",
+			params: []apiParam{runName}, request: XForkRequest{}, requestTypes: structured,
+			status: 201, response: XGameRun{}, responseTypes: runTypes},
+		{method: "GET", path: "/runs/{name}/events", summary: "list edits, continues and rewinds",
+			params: []apiParam{runName}, status: 200, response: XRunEventList{}, responseTypes: structured},
+		{method: "PUT", path: "/runs/{name}/pin", summary: "pin a run so retention limits never evict it",
+			params: []apiParam{runName}, status: 204},
+		{method: "DELETE", path: "/runs/{name}/pin", summary: "unpin a run",
+			params: []apiParam{runName}, status: 204},
+		{method: "GET", path: "/diff", summary: "compare run a from cycle i with run b from cycle j",
+			params: []apiParam{requiredParam(queryParam("a", "string", "run a")),
+				queryParam("b", "string", "run b (default a)"),
+				queryParam("i", "integer", "cycle of a (default 0)"),
+				queryParam("j", "integer", "cycle of b (default 0)"),
+				queryParam("steps", "integer", "pairs to compare after the first (default all)")},
+			status: 200, response: XDiff{}, responseTypes: []string{jsonType, xmlType, pngType, gifType}},
+		{method: "GET", path: "/patterns", summary: "list the pattern library",
+			status: 200, response: XPatternList{}, responseTypes: structured},
+		{method: "GET", path: "/patterns/{name}", summary: "get a library pattern",
+			params: []apiParam{pathParam("name", "string", "pattern name")},
+			status: 200, response: XPattern{}, responseTypes: structured},
+		{method: "GET", path: "/metrics", summary: "get metrics (Prometheus text format)",
+			status: 200, responseTypes: []string{textType}},
+		{method: "GET", path: "/openapi.json", summary: "get this document",
+			status: 200, responseTypes: []string{jsonType}},
+		{method: "GET", path: "/", summary: "redirect to the web UI", status: 302},
+		{method: "GET", path: "/ui/{file}", summary: "get a web UI file",
+			params: []apiParam{pathParam("file", "string", "file name")},
+			status: 200, responseTypes: []string{htmlType}},
+	}
+}()
+
+// Builds component schemas from Go types.
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+// Get the schema of a type; named struct types become references.
+func (sb *schemaBuilder) schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return sb.schemaOf(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": sb.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sb.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "Time" {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if _, ok := sb.schemas[t.Name()]; !ok {
+			sb.schemas[t.Name()] = nil // placeholder for recursive types
+			sb.schemas[t.Name()] = sb.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// Get the schema of a struct from its exported fields' JSON tags.
+func (sb *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var needed []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name, options := f.Name, ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.SplitN(tag, ",", 2)
+			if len(parts[0]) > 0 {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				options = parts[1]
+			}
+		}
+		properties[name] = sb.schemaOf(f.Type)
+		if !strings.Contains(options, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			needed = append(needed, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(needed) > 0 {
+		sort.Strings(needed)
+		schema["required"] = needed
+	}
+	return schema
+}
+
+// Make the OpenAPI document.
+func makeOpenAPI() map[string]interface{} {
+	sb := &schemaBuilder{schemas: map[string]interface{}{}}
+	errorContent := map[string]interface{}{jsonType: map[string]interface{}{
+		"schema": sb.schemaOf(reflect.TypeOf(XError{}))}}
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		item, ok := paths[op.path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.path] = item
+		}
+		operation := map[string]interface{}{"summary": op.summary}
+		var params []interface{}
+		for _, p := range op.params {
+			param := map[string]interface{}{"name": p.name, "in": p.in,
+				"schema": map[string]interface{}{"type": p.kind}}
+			if len(p.description) > 0 {
+				param["description"] = p.description
+			}
+			if p.required {
+				param["required"] = true
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if len(op.requestTypes) > 0 {
+			operation["requestBody"] = map[string]interface{}{
+				"content": sb.content(op.request, op.requestTypes)}
+		}
+		success := map[string]interface{}{"description": http.StatusText(op.status)}
+		if len(op.responseTypes) > 0 {
+			success["content"] = sb.content(op.response, op.responseTypes)
+		}
+		operation["responses"] = map[string]interface{}{
+			fmt.Sprint(op.status): success,
+			"default":             map[string]interface{}{"description": "error", "content": errorContent},
+		}
+		if !isPublicPath(op.path) {
+			operation["security"] = []interface{}{map[string]interface{}{"bearer": []string{}},
+				map[string]interface{}{"apiKey": []string{}}, map[string]interface{}{"basic": []string{}}}
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{"title": "Game of Life server", "version": APIVersion,
+			"description": "Play Conway's Game of Life (and other Life-like rules). " +
+				"If the server has an auth file, operations with security need an API key."},
+		"paths": paths,
+		"components": map[string]interface{}{"schemas": sb.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			}},
+	}
+}
+
+// Get the content (by media type) of a body; structured types get the
+// value's schema, others are strings (binary for images).
+func (sb *schemaBuilder) content(v interface{}, types []string) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, mt := range types {
+		structured := strings.HasSuffix(mt, "json") || strings.HasSuffix(mt, "xml") ||
+			strings.HasSuffix(mt, "yaml") || mt == formType
+		schema := map[string]interface{}{"type": "string", "format": "binary"}
+		switch {
+		case structured && v != nil:
+			schema = sb.schemaOf(reflect.TypeOf(v))
+		case structured || strings.HasPrefix(mt, "text/"):
+			schema = map[string]interface{}{"type": "string"}
+		}
+		content[mt] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+// Report if a described path is served without authentication.
+func isPublicPath(path string) bool {
+	for p := range publicPaths {
+		if path == p || p != "/" && strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check every registered path is described; a path ending in "/" is a
+// prefix for described paths under it.
+func checkOpenAPI(paths []string) (err error) {
+	var missing []string
+	for _, p := range paths {
+		found := false
+		for _, op := range apiOperations {
+			if op.path == p || strings.HasSuffix(p, "/") && p != "/" &&
+				strings.HasPrefix(op.path, p) && len(op.path) > len(p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		err = fmt.Errorf("paths missing from the OpenAPI document: %v", missing)
+	}
+	return
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// OpenAPI request handler.
+func openAPIHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.Header().Set("Allow", "GET")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.MarshalIndent(makeOpenAPI(), "", "  ") // cannot fail
+	})
+	writer.Header().Set("Content-Type", jsonType)
+	writer.Write(openAPIJSON) // send response; error ignored
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"embed"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Built-in pattern library.
+// Patterns are RLE files embedded from the patterns directory; the file
+// name (less ".rle") is the pattern name. A pattern is placed on a board
+// with a "pattern:" URL, ex. "pattern:gosper-gun?x=10&y=20&w=200&h=200".
+// The board (w, h) defaults to the pattern size; the position (x, y)
+// defaults to the board center.
+
+//go:embed patterns/*.rle
+var patternFiles embed.FS
+
+const PatternPrefix = "pattern:" // built-in pattern (vs. file or network)
+
+// Pattern categories by name; others are "other".
+var patternCategories = map[string]string{
+	"block": "still life", "beehive": "still life", "loaf": "still life", "boat": "still life",
+	"blinker": "oscillator", "toad": "oscillator", "beacon": "oscillator",
+	"pulsar": "oscillator", "pentadecathlon": "oscillator",
+	"glider": "spaceship", "lwss": "spaceship", "mwss": "spaceship", "hwss": "spaceship",
+	"gosper-gun":  "gun",
+	"r-pentomino": "methuselah", "acorn": "methuselah", "diehard": "methuselah",
+	"puffer-train": "puffer",
+}
+
+// A library pattern.
+type XPattern struct {
+	Name        string `json:"name" xml:"Name"`
+	Title       string `json:"title" xml:"Title"`
+	Category    string `json:"category" xml:"Category"`
+	Description string `json:"description,omitempty" xml:"Description,omitempty"`
+	Width       int    `json:"width" xml:"Width"`
+	Height      int    `json:"height" xml:"Height"`
+	RLE         string `json:"rle,omitempty" xml:"RLE,omitempty"`
+	grid        *Grid
+}
+
+// A list of library patterns.
+type XPatternList struct {
+	XMLName  xml.Name    `json:"-" xml:"Patterns"`
+	Patterns []*XPattern `json:"patterns" xml:"Pattern"`
+}
+
+// Error values.
+var UnknownPatternError = errors.New("unknown pattern")
+
+// The library by name.
+var Patterns = loadPatterns()
+
+// Parse the embedded pattern files; fails if any is bad.
+func loadPatterns() (patterns map[string]*XPattern) {
+	patterns = make(map[string]*XPattern)
+	files, err := patternFiles.ReadDir("patterns")
+	fatalIfError(err)
+	for _, f := range files {
+		b, err := patternFiles.ReadFile(path.Join("patterns", f.Name()))
+		fatalIfError(err)
+		text := string(b)
+		grid, err := ParseRLE(text)
+		fatalIfError(err)
+		name := strings.TrimSuffix(f.Name(), ".rle")
+		p := &XPattern{Name: name, Title: name, Category: patternCategories[name],
+			Width: grid.Width, Height: grid.Height, RLE: text, grid: grid}
+		if len(p.Category) == 0 {
+			p.Category = "other"
+		}
+		for _, line := range strings.Split(text, "\n") {
+			switch {
+			case strings.HasPrefix(line, "#N "):
+				p.Title = strings.TrimSpace(line[3:])
+			case strings.HasPrefix(line, "#C "):
+				p.Description = strings.TrimSpace(p.Description + " " + line[3:])
+			}
+		}
+		patterns[name] = p
+	}
+	return
+}
+
+// Get the sorted pattern names.
+func PatternNames() (names []string) {
+	for name := range Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Make the grid for a "pattern:" URL.
+func LoadPattern(url string) (grid *Grid, err error) {
+	spec := strings.TrimPrefix(url, PatternPrefix)
+	name, query := spec, ""
+	if i := strings.Index(spec, "?"); i >= 0 {
+		name, query = spec[:i], spec[i+1:]
+	}
+	p, ok := Patterns[strings.ToLower(name)]
+	if !ok {
+		err = fmt.Errorf("%w: %q", UnknownPatternError, name)
+		return
+	}
+	values, err := neturl.ParseQuery(query)
+	if err != nil {
+		return
+	}
+	w, h := p.Width, p.Height
+	if w, err = patternParam(values, "w", w); err != nil {
+		return
+	}
+	if h, err = patternParam(values, "h", h); err != nil {
+		return
+	}
+	if err = checkSeedSize(w, h); err != nil {
+		return
+	}
+	x, y := (w-p.Width)/2, (h-p.Height)/2
+	if x, err = patternParam(values, "x", x); err != nil {
+		return
+	}
+	if y, err = patternParam(values, "y", y); err != nil {
+		return
+	}
+	if x < 0 || y < 0 || x+p.Width > w || y+p.Height > h {
+		err = fmt.Errorf("pattern %s (%dx%d) at %d,%d does not fit a %dx%d board",
+			p.Name, p.Width, p.Height, x, y, w, h)
+		return
+	}
+	grid = NewEmptyGrid(w, h)
+	for row := 0; row < p.Height; row++ {
+		for col := 0; col < p.Width; col++ {
+			grid.setCell(x+col, y+row, p.grid.getCell(col, row))
+		}
+	}
+	return
+}
+
+// Get an integer pattern URL parameter.
+func patternParam(values neturl.Values, name string, def int) (v int, err error) {
+	xv := values.Get(name)
+	if len(xv) == 0 {
+		return def, nil
+	}
+	v, err = strconv.Atoi(xv)
+	if err != nil {
+		err = fmt.Errorf("bad pattern parameter %s=%q", name, xv)
+	}
+	return
+}
+
+// Make a grayscale image of a grid; live cells are black.
+func GridImage(grid *Grid) image.Image {
+	img := image.NewGray(image.Rect(0, 0, grid.Width, grid.Height))
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) == 0 {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+// Patterns request handler.
+//
+//	GET /patterns         list the library
+//	GET /patterns/{name}  get a pattern (with its RLE)
+func patternsHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.Header().Set("Allow", "GET")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	ct, ok := negotiate(request, jsonType, xmlType)
+	if !ok {
+		sendError(writer, 406, "supported types: %s, %s", jsonType, xmlType)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(request.URL.Path, "/patterns"), "/")
+	if len(name) > 0 {
+		p, ok := Patterns[name]
+		if !ok {
+			sendError(writer, 404, "pattern %q not found", name)
+			return
+		}
+		sendValue(writer, 200, ct, p)
+		return
+	}
+	list := &XPatternList{Patterns: []*XPattern{}}
+	for _, name := range PatternNames() {
+		p := *Patterns[name]
+		p.RLE = ""
+		list.Patterns = append(list.Patterns, &p)
+	}
+	sendValue(writer, 200, ct, list)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Get a grid's live cells, cropped to their bounds, as plaintext rows.
+func croppedRows(grid *Grid) string {
+	minX, minY, maxX, maxY := grid.Width, grid.Height, -1, -1
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				minX, minY = minInt(minX, x), minInt(minY, y)
+				maxX, maxY = maxInt(maxX, x), maxInt(maxY, y)
+			}
+		}
+	}
+	if maxX < 0 {
+		return ""
+	}
+	return gridRows(grid.window(minX+grid.X, minY+grid.Y, maxX-minX+1, maxY-minY+1))
+}
+
+func TestLibraryPatterns(t *testing.T) {
+	// Still lifes, oscillators and spaceships return to their shape after
+	// their period.
+	periods := map[string]int{"block": 1, "beehive": 1, "loaf": 1, "boat": 1,
+		"blinker": 2, "toad": 2, "beacon": 2, "pulsar": 3, "pentadecathlon": 15,
+		"glider": 4, "lwss": 4, "mwss": 4, "hwss": 4}
+	if len(Patterns) < len(periods) {
+		t.Fatalf("got %d library patterns, want at least %d", len(Patterns), len(periods))
+	}
+	for _, name := range PatternNames() {
+		p := Patterns[name]
+		if gridPopulation(p.grid) == 0 {
+			t.Errorf("%s: no live cells", name)
+		}
+		period, ok := periods[name]
+		if !ok {
+			continue
+		}
+		url := fmt.Sprintf("%s%s?w=%d&h=%d", PatternPrefix, name, p.Width+20, p.Height+20)
+		grid, err := LoadPattern(url)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		g := &Game{Runs: make(map[string]*GameRun), Quiet: true}
+		gr, err := g.RunGrid(name, url, grid, RunParams{Cycles: period})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := croppedRows(gr.CurrentGrid), croppedRows(grid); got != want {
+			t.Errorf("%s: after %d cycles got\n%swant\n%s", name, period, got, want)
+		}
+	}
+}
+
+func TestLoadPattern(t *testing.T) {
+	grid, err := LoadPattern(PatternPrefix + "glider?w=7&h=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gridRows(grid), ".......\n...O...\n....O..\n..OOO..\n.......\n"; got != want {
+		t.Errorf("centered: got\n%swant\n%s", got, want)
+	}
+	grid, err = LoadPattern(PatternPrefix + "Glider?w=4&h=4&x=1&y=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gridRows(grid), "..O.\n...O\n.OOO\n....\n"; got != want {
+		t.Errorf("placed: got\n%swant\n%s", got, want)
+	}
+	for _, url := range []string{"glider?w=2", "glider?x=-1", "glider?w=4&x=2", "glider?w=x"} {
+		if _, err = LoadPattern(PatternPrefix + url); err == nil {
+			t.Errorf("%s: no error", url)
+		}
+	}
+	if _, err = LoadPattern(PatternPrefix + "nope"); !errors.Is(err, UnknownPatternError) {
+		t.Errorf("got %v, want %v", err, UnknownPatternError)
+	}
+}
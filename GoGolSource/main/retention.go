@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Run retention.
+// A game can limit the runs it holds by count, total grid bytes and age
+// (since the run started). Runs over the age limit are evicted first, then
+// the least recently viewed runs until the game is within the count and
+// bytes limits. Pinned runs and runs being played are never evicted.
+// Evictions are logged, counted (gol_runs_evicted_total) and listed by
+// GET /history.
+
+// Retention limits; zero values are unlimited.
+type Retention struct {
+	MaxRuns  int
+	MaxBytes int64 // of grids held by runs
+	MaxAge   time.Duration
+}
+
+// Eviction reasons.
+const (
+	maxRunsReason  = "maxRuns"
+	maxBytesReason = "maxBytes"
+	maxAgeReason   = "maxAge"
+)
+
+// Number of evictions a game remembers.
+const evictionHistory = 100
+
+// How often limits are checked without new runs (for the age limit).
+var retentionSweep = time.Minute
+
+// A run evicted from a game.
+type XEviction struct {
+	Name      string `json:"name" xml:"Name"`
+	Reason    string `json:"reason" xml:"Reason"`
+	At        int64  `json:"atNS" xml:"AtEpochNS"`
+	Cycles    int    `json:"cycles" xml:"Cycles"`
+	GridBytes int64  `json:"gridBytes" xml:"GridBytes"`
+}
+
+// Set a game's retention limits and apply them.
+func (g *Game) SetRetention(r Retention) {
+	g.lock.Lock()
+	g.Retention = r
+	g.lock.Unlock()
+	g.Retain()
+}
+
+// Get a run by name and record it was viewed.
+func (g *Game) ViewRun(name string) (gr *GameRun, ok bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	gr, ok = g.Runs[name]
+	if ok {
+		gr.ViewedAt = time.Now()
+	}
+	return
+}
+
+// Pin (or unpin) a run so it is never evicted; reports if it exists.
+func (g *Game) Pin(name string, pinned bool) (ok bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	gr, ok := g.Runs[name]
+	if ok {
+		gr.Pinned = pinned
+	}
+	return
+}
+
+// Get a run's pinned state and when it was last viewed.
+func (gr *GameRun) retention() (pinned bool, viewedAt time.Time) {
+	if gr.Parent == nil {
+		return gr.Pinned, gr.ViewedAt
+	}
+	gr.Parent.lock.Lock()
+	defer gr.Parent.lock.Unlock()
+	return gr.Pinned, gr.ViewedAt
+}
+
+// Report if a run was played and is not playing or being changed.
+func (gr *GameRun) idle() bool {
+	if !gr.lock.TryLock() {
+		return false
+	}
+	defer gr.lock.Unlock()
+	return !gr.busy && !gr.EndedAt.IsZero()
+}
+
+// Get the recent evictions, most recent first.
+func (g *Game) Evictions() (evictions []*XEviction) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for i := len(g.evictions) - 1; i >= 0; i-- {
+		evictions = append(evictions, g.evictions[i])
+	}
+	return
+}
+
+// Evict runs over the game's retention limits.
+func (g *Game) Retain() (evicted []*XEviction) {
+	g.lock.Lock()
+	r := g.Retention
+	if r.MaxRuns <= 0 && r.MaxBytes <= 0 && r.MaxAge <= 0 {
+		g.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	count, bytes := len(g.Runs), int64(0)
+	var candidates []*GameRun
+	for _, gr := range g.Runs {
+		bytes += gr.GridBytes()
+		if gr.Pinned || !gr.idle() {
+			continue // pinned or being played
+		}
+		candidates = append(candidates, gr)
+	}
+	evict := func(gr *GameRun, reason string) {
+		n := gr.GridBytes()
+		_, _, cycles := gr.size()
+		delete(g.Runs, gr.Name)
+		count, bytes = count-1, bytes-n
+		evicted = append(evicted, &XEviction{Name: gr.Name, Reason: reason,
+			At: now.UnixNano(), Cycles: cycles, GridBytes: n})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ViewedAt.Before(candidates[j].ViewedAt)
+	})
+	kept := candidates[:0]
+	for _, gr := range candidates {
+		if r.MaxAge > 0 && now.Sub(gr.StartedAt) > r.MaxAge {
+			evict(gr, maxAgeReason)
+		} else {
+			kept = append(kept, gr)
+		}
+	}
+	for _, gr := range kept {
+		switch {
+		case r.MaxRuns > 0 && count > r.MaxRuns:
+			evict(gr, maxRunsReason)
+		case r.MaxBytes > 0 && bytes > r.MaxBytes:
+			evict(gr, maxBytesReason)
+		}
+	}
+	g.evictions = append(g.evictions, evicted...)
+	if extra := len(g.evictions) - evictionHistory; extra > 0 {
+		g.evictions = append([]*XEviction(nil), g.evictions[extra:]...)
+	}
+	g.lock.Unlock()
+	for _, xe := range evicted {
+		runsEvicted.Inc(xe.Reason)
+		fmt.Printf("Evicted run %s (%s): %d cycles, %d grid bytes\n",
+			xe.Name, xe.Reason, xe.Cycles, xe.GridBytes)
+	}
+	return
+}
+
+// Apply the retention limits of every game until stop is closed.
+func sweepRuns(stop <-chan struct{}) {
+	ticker := time.NewTicker(retentionSweep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, g := range allGames() {
+				g.Retain()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Default rule (Conway's Life).
+const DefaultRuleName = "B3/S23"
+
+// Represents a Life-like rule as birth and survival neighbor counts.
+type Rule struct {
+	Name    string
+	Birth   [9]bool
+	Survive [9]bool
+}
+
+var BadRuleError = errors.New("bad rule")
+
+// Parse a rule in B/S notation (ex. "B3/S23") or S/B notation (ex. "23/3").
+func ParseRule(text string) (r *Rule, err error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	if len(text) == 0 {
+		text = DefaultRuleName
+	}
+	parts := strings.Split(text, "/")
+	if len(parts) != 2 {
+		err = BadRuleError
+		return
+	}
+	r = &Rule{}
+	birth, survive := parts[0], parts[1]
+	switch {
+	case strings.HasPrefix(birth, "B") && strings.HasPrefix(survive, "S"):
+		birth, survive = birth[1:], survive[1:]
+	case strings.HasPrefix(birth, "S") && strings.HasPrefix(survive, "B"):
+		birth, survive = survive[1:], birth[1:]
+	default:
+		birth, survive = survive, birth // S/B notation
+	}
+	if err = setCounts(&r.Birth, birth); err != nil {
+		return nil, err
+	}
+	if err = setCounts(&r.Survive, survive); err != nil {
+		return nil, err
+	}
+	r.Name = r.String()
+	return
+}
+
+// Mark the neighbor counts named by the digits.
+func setCounts(counts *[9]bool, digits string) (err error) {
+	for _, c := range digits {
+		if c < '0' || c > '8' {
+			return fmt.Errorf("%w: %q", BadRuleError, digits)
+		}
+		counts[c-'0'] = true
+	}
+	return
+}
+
+// Get the canonical B/S form of a rule.
+func (r *Rule) String() string {
+	var sb strings.Builder
+	sb.WriteString("B")
+	for i, set := range r.Birth {
+		if set {
+			sb.WriteByte(byte('0' + i))
+		}
+	}
+	sb.WriteString("/S")
+	for i, set := range r.Survive {
+		if set {
+			sb.WriteByte(byte('0' + i))
+		}
+	}
+	return sb.String()
+}
+
+// Get the next cell state given the current state and live neighbor count.
+func (r *Rule) Next(cell byte, neighbors int) byte {
+	if cell != 0 {
+		if r.Survive[neighbors] {
+			return 1
+		}
+		return 0
+	}
+	if r.Birth[neighbors] {
+		return 1
+	}
+	return 0
+}
+
+// Conway's rule; always parses.
+var ConwayRule, _ = ParseRule(DefaultRuleName)
@@ -0,0 +1,801 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Resource style API over game runs:
+//   POST   /runs                    create (and play) a run from JSON, a
+//                                   form upload or a raw seed body
+//   GET    /runs                    list runs (paged, filtered)
+//   GET    /runs/{name}             get a run
+//   DELETE /runs/{name}             delete a run
+//   GET    /runs/{name}/cycles/{n}  get a cycle (JSON, XML, PNG or RLE)
+//   GET    /runs/{name}/board       get the current grid (JSON, XML, PNG or RLE)
+//   POST   /runs/{name}/edits       edit the current grid (one edit or a list)
+//   POST   /runs/{name}/continue    play more cycles (?cycles=n, default 1)
+//   POST   /runs/{name}/rewind      rewind to a cycle (?cycle=n), discarding later ones
+//   POST   /runs/{name}/fork        fork at a cycle into a new run
+//   PUT    /runs/{name}/pin         pin (DELETE unpins); pinned runs are never evicted
+//   GET    /runs/{name}/events      list edits, continues and rewinds
+
+// Request body to create a run.
+// The seed is either fetched from Source or supplied directly in Seed
+// (base64 in JSON) in any supported image or pattern format.
+type XRunRequest struct {
+	Name       string `json:"name" xml:"Name"`
+	Source     string `json:"source,omitempty" xml:"Source,omitempty"`
+	Seed       []byte `json:"seed,omitempty" xml:"Seed,omitempty"`
+	Rule       string `json:"rule,omitempty" xml:"Rule,omitempty"`
+	Cycles     int    `json:"cycles,omitempty" xml:"Cycles,omitempty"`
+	Goroutines int    `json:"goroutines,omitempty" xml:"Goroutines,omitempty"`
+	AutoTune   bool   `json:"autoTune,omitempty" xml:"AutoTune,omitempty"` // pick goroutines
+	Kernel     string `json:"kernel,omitempty" xml:"Kernel,omitempty"`
+	Topology   string `json:"topology,omitempty" xml:"Topology,omitempty"`
+	Delay      int    `json:"delay,omitempty" xml:"Delay,omitempty"`   // GIF frame delay (10ms units)
+	Pinned     bool   `json:"pinned,omitempty" xml:"Pinned,omitempty"` // never evicted
+	Priority   string `json:"priority,omitempty" xml:"Priority,omitempty"`
+}
+
+// Request body to fork a run.
+// Cycle defaults to the run's current cycle; Cycles (to play) defaults to
+// the number the parent played after Cycle.
+type XForkRequest struct {
+	Name       string   `json:"name" xml:"Name"`
+	Cycle      *int     `json:"cycle,omitempty" xml:"Cycle,omitempty"`
+	Rule       string   `json:"rule,omitempty" xml:"Rule,omitempty"`
+	Cycles     int      `json:"cycles,omitempty" xml:"Cycles,omitempty"`
+	Goroutines int      `json:"goroutines,omitempty" xml:"Goroutines,omitempty"`
+	AutoTune   bool     `json:"autoTune,omitempty" xml:"AutoTune,omitempty"`
+	Kernel     string   `json:"kernel,omitempty" xml:"Kernel,omitempty"`
+	Topology   string   `json:"topology,omitempty" xml:"Topology,omitempty"`
+	Edits      []*XEdit `json:"edits,omitempty" xml:"Edits>Edit,omitempty"`
+	Pinned     bool     `json:"pinned,omitempty" xml:"Pinned,omitempty"`
+	Priority   string   `json:"priority,omitempty" xml:"Priority,omitempty"`
+}
+
+// A page of runs.
+type XRunList struct {
+	Total  int         `json:"total" xml:"Total"`
+	Offset int         `json:"offset" xml:"Offset"`
+	Limit  int         `json:"limit" xml:"Limit"`
+	Runs   []*XGameRun `json:"runs" xml:"Runs>GameRun"`
+}
+
+// Error returned to clients.
+type XError struct {
+	XMLName xml.Name `json:"-" xml:"Error"`
+	Status  int      `json:"status" xml:"Status"`
+	Error   string   `json:"error" xml:"Error"`
+	Message string   `json:"message" xml:"Message"`
+}
+
+// Paging limits.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// Media types.
+const (
+	jsonType = "application/json"
+	xmlType  = "application/xml"
+	pngType  = "image/png"
+	gifType  = "image/gif"
+	rleType  = "text/x-rle"
+)
+
+// Send a structured error.
+func sendError(writer http.ResponseWriter, status int, format string, args ...interface{}) {
+	xe := &XError{Status: status, Error: http.StatusText(status),
+		Message: fmt.Sprintf(format, args...)}
+	ba, _ := json.MarshalIndent(xe, "", "  ") // cannot fail
+	writer.Header().Set("Content-Type", jsonType)
+	writer.WriteHeader(status)
+	writer.Write(ba) // send response; error ignored
+}
+
+// Send a value formatted for a media type (JSON if it has no formatter).
+func sendValue(writer http.ResponseWriter, status int, ct string, v interface{}) {
+	f, ok := Formatters[ct]
+	if !ok {
+		ct, f = jsonType, Formatters[jsonType]
+	}
+	ba, err := f.ValueToText(v)
+	if err != nil {
+		sendError(writer, 500, "cannot format response: %v", err)
+		return
+	}
+	writer.Header().Set("Content-Type", ct)
+	writer.WriteHeader(status)
+	writer.Write(ba) // send response; error ignored
+}
+
+// Choose a response type from the "format" parameter or Accept header.
+// The offer with the highest quality wins; ties go to the range listed
+// first in the header, then to the earlier offer. The first offer is the
+// default.
+func negotiate(request *http.Request, offers ...string) (ct string, ok bool) {
+	if format := strings.ToLower(request.URL.Query().Get("format")); len(format) > 0 {
+		for _, offer := range offers {
+			if strings.HasSuffix(offer, "/"+format) || strings.HasSuffix(offer, "/x-"+format) {
+				return offer, true
+			}
+		}
+		return
+	}
+	accept := request.Header.Get("Accept")
+	if len(accept) == 0 {
+		return offers[0], true
+	}
+	bestQ, bestPosition := 0.0, 0
+	for _, offer := range offers {
+		q, position := acceptQuality(accept, offer)
+		if q > bestQ || q > 0 && q == bestQ && position < bestPosition {
+			ct, ok, bestQ, bestPosition = offer, true, q, position
+		}
+	}
+	return
+}
+
+// Get the quality an Accept header gives a media type, from the most
+// specific range matching it, and that range's position in the header.
+func acceptQuality(accept, mt string) (q float64, position int) {
+	specificity := -1
+	for i, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		r, s := canonicalType(fields[0]), -1
+		switch {
+		case r == mt:
+			s = 2
+		case r == mt[:strings.Index(mt, "/")]+"/*":
+			s = 1
+		case r == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q, position = s, 1, i
+		for _, param := range fields[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+	}
+	return
+}
+
+// Validate a run request and create the run.
+// Returns an HTTP status and message on failure.
+// The endpoint names the API used (for metrics).
+func createRun(request *http.Request, endpoint string, rr *XRunRequest,
+	replace bool) (gr *GameRun, status int, err error) {
+	defer func() {
+		observeRunOutcome(endpoint, err)
+	}()
+	game := requestGame(request)
+	switch {
+	case len(rr.Name) == 0:
+		return nil, 400, fmt.Errorf("name is required")
+	case strings.Contains(rr.Name, "/"):
+		return nil, 400, fmt.Errorf("name cannot contain '/'")
+	case len(rr.Source) == 0 && len(rr.Seed) == 0:
+		return nil, 400, fmt.Errorf("source or seed is required")
+	}
+	params := RunParams{Cycles: rr.Cycles, Goroutines: rr.Goroutines, AutoTune: rr.AutoTune, Rule: rr.Rule,
+		Kernel: rr.Kernel, Topology: rr.Topology, Delay: rr.Delay, Pinned: rr.Pinned,
+		Priority: rr.Priority, Context: request.Context()}
+	if err = params.Check(); err != nil {
+		return nil, 400, err
+	}
+	if status, err = checkPriority(request, rr.Priority); err != nil {
+		return
+	}
+	if _, exists := game.GetRun(rr.Name); exists && !replace {
+		return nil, 409, fmt.Errorf("run %q already exists", rr.Name)
+	}
+	var done func(int64)
+	params.Admit = requestUser(request).runAdmitter(endpoint, &done, &status)
+	defer func() {
+		switch {
+		case done == nil: // not admitted
+		case gr != nil:
+			done(gr.cellCycles())
+		default:
+			done(0)
+		}
+	}()
+	if len(rr.Seed) > 0 {
+		grid, kind, xerr := DecodeSeed(rr.Seed)
+		if xerr != nil {
+			return nil, 415, fmt.Errorf("cannot decode seed: %v", xerr)
+		}
+		source := rr.Source
+		if len(source) == 0 {
+			source = uploadPrefix + kind
+		}
+		gr, err = game.RunGrid(rr.Name, source, grid, params)
+	} else {
+		gr, err = game.RunWith(rr.Name, rr.Source, params)
+	}
+	switch {
+	case errors.Is(err, QuotaError):
+		return nil, status, err
+	case errors.Is(err, QueueFullError):
+		return nil, 503, err
+	case err != nil:
+		return nil, 422, fmt.Errorf("cannot run %q: %v", rr.Source, err)
+	}
+	return gr, 201, nil
+}
+
+// Source recorded for uploaded seeds; followed by the sniffed kind.
+const uploadPrefix = "upload:"
+
+// Names of the multipart form (or url encoded form) field holding a seed.
+var seedFields = []string{"seed", "file"}
+
+// Read a run request from a JSON body, a multipart form upload or a raw
+// seed body. For forms and raw bodies the other values come from form
+// fields or query parameters.
+func readRunRequest(writer http.ResponseWriter, request *http.Request) (rr *XRunRequest, err error) {
+	request.Body = http.MaxBytesReader(writer, request.Body, MaxSeedBytes+maxFormOverhead)
+	rr = &XRunRequest{}
+	mt, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	switch mt {
+	case jsonType, "text/json":
+		err = json.NewDecoder(request.Body).Decode(rr)
+		return
+	case "multipart/form-data":
+		err = request.ParseMultipartForm(MaxSeedBytes)
+		if err != nil {
+			return
+		}
+		for _, field := range seedFields {
+			var file multipart.File
+			file, _, err = request.FormFile(field)
+			if err == http.ErrMissingFile {
+				err = nil
+				if seed := request.PostForm.Get(field); len(seed) > 0 {
+					rr.Seed = []byte(seed) // text field
+					break
+				}
+				continue
+			}
+			if err != nil {
+				return
+			}
+			rr.Seed, err = ioutil.ReadAll(file)
+			file.Close() // error ignored
+			if err != nil {
+				return
+			}
+			break
+		}
+	default:
+		// raw seed body; may be mislabeled as a url encoded form or be JSON
+		var b []byte
+		b, err = ioutil.ReadAll(request.Body)
+		if err != nil {
+			return
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) &&
+			json.Unmarshal(b, rr) == nil {
+			return // mislabeled JSON
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if request.ParseForm() == nil {
+			for _, field := range seedFields {
+				if seed := request.PostForm.Get(field); len(seed) > 0 {
+					rr.Seed = []byte(seed)
+					break
+				}
+			}
+		}
+		if len(rr.Seed) == 0 {
+			rr.Seed = b
+			request.PostForm = nil
+			request.Form = request.URL.Query()
+		}
+	}
+	err = readRunForm(request.Form, rr)
+	return
+}
+
+// Read run request values (except the seed) from form fields or query
+// parameters.
+func readRunForm(form url.Values, rr *XRunRequest) (err error) {
+	rr.Name = form.Get("name")
+	rr.Source = form.Get("url")
+	rr.Rule = form.Get("rule")
+	rr.Kernel = form.Get("kernel")
+	rr.Topology = form.Get("topology")
+	rr.Pinned = form.Get("pinned") == "true"
+	rr.Priority = form.Get("priority")
+	rr.AutoTune = form.Get("autoTune") == "true"
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{{"cycles", &rr.Cycles}, {"goroutines", &rr.Goroutines}, {"delay", &rr.Delay}} {
+		xv := form.Get(p.name)
+		if p.name == "goroutines" && xv == AutoGoroutines {
+			rr.AutoTune = true
+			continue
+		}
+		if len(xv) > 0 {
+			*p.v, err = strconv.Atoi(xv)
+			if err != nil {
+				return fmt.Errorf("bad %s: %v", p.name, err)
+			}
+		}
+	}
+	return
+}
+
+// Get the status for a request body read failure.
+func bodyErrorStatus(err error) int {
+	if _, tooBig := err.(*http.MaxBytesError); tooBig {
+		return 413
+	}
+	return 400
+}
+
+// Allowance for form fields beyond the seed.
+const maxFormOverhead = 64 << 10
+
+// Select a page of runs.
+func listRuns(game *Game, offset, limit int, prefix, source, rule string) (list *XRunList) {
+	list = &XRunList{Offset: offset, Limit: limit, Runs: make([]*XGameRun, 0, limit)}
+	for _, name := range game.RunNames() {
+		gr, ok := game.GetRun(name)
+		switch {
+		case !ok,
+			!strings.HasPrefix(name, prefix),
+			!strings.Contains(gr.ImageURL, source),
+			len(rule) > 0 && gr.Rule.String() != rule:
+			continue
+		}
+		if list.Total >= offset && len(list.Runs) < limit {
+			list.Runs = append(list.Runs, makeReturnedRun(gr))
+		}
+		list.Total++
+	}
+	return
+}
+
+// Get an optional non-negative integer query parameter.
+func intParam(request *http.Request, name string, def int) (v int, err error) {
+	xv := request.URL.Query().Get(name)
+	if len(xv) == 0 {
+		return def, nil
+	}
+	v, err = strconv.Atoi(xv)
+	if err == nil && v < 0 {
+		err = fmt.Errorf("%s cannot be negative", name)
+	}
+	return
+}
+
+// Runs collection request handler.
+func runsHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/runs" {
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
+		return
+	}
+	switch request.Method {
+	case "GET":
+		ct, ok := negotiate(request, runTypes...)
+		if !ok {
+			sendError(writer, 406, "supported types: %s", strings.Join(runTypes, ", "))
+			return
+		}
+		offset, err := intParam(request, "offset", 0)
+		if err != nil {
+			sendError(writer, 400, "bad offset: %v", err)
+			return
+		}
+		limit, err := intParam(request, "limit", defaultPageLimit)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			sendError(writer, 400, "limit must be 1 to %d", maxPageLimit)
+			return
+		}
+		query := request.URL.Query()
+		rule := query.Get("rule")
+		if len(rule) > 0 {
+			r, err := ParseRule(rule)
+			if err != nil {
+				sendError(writer, 400, "bad rule: %v", err)
+				return
+			}
+			rule = r.String()
+		}
+		list := listRuns(requestGame(request), offset, limit, query.Get("prefix"), query.Get("source"), rule)
+		sendValue(writer, 200, ct, list)
+	case "POST":
+		ct, ok := negotiate(request, runTypes...)
+		if !ok {
+			sendError(writer, 406, "supported types: %s", strings.Join(runTypes, ", "))
+			return
+		}
+		rr, err := readRunRequest(writer, request)
+		if err != nil {
+			sendError(writer, bodyErrorStatus(err), "bad request body: %v", err)
+			return
+		}
+		gr, status, err := createRun(request, "runs", rr, false)
+		if err != nil {
+			sendError(writer, status, "%v", err)
+			return
+		}
+		writer.Header().Set("Location", "/runs/"+gr.Name)
+		sendValue(writer, status, ct, makeReturnedRun(gr))
+	default:
+		writer.Header().Set("Allow", "GET, POST")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+	}
+}
+
+// Single run request handler.
+func runHandler(writer http.ResponseWriter, request *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(request.URL.Path, "/runs/"), "/")
+	name := parts[0]
+	game := requestGame(request)
+	gr, ok := game.ViewRun(name)
+	if !ok {
+		sendError(writer, 404, "run %q not found", name)
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		switch request.Method {
+		case "GET":
+			ct, ok := negotiate(request, runTypes...)
+			if !ok {
+				sendError(writer, 406, "supported types: %s", strings.Join(runTypes, ", "))
+				return
+			}
+			sendValue(writer, 200, ct, makeReturnedRun(gr))
+		case "DELETE":
+			game.RemoveRun(name)
+			writer.WriteHeader(204)
+		default:
+			writer.Header().Set("Allow", "GET, DELETE")
+			sendError(writer, 405, "method %s not allowed", request.Method)
+		}
+	case len(parts) == 3 && parts[1] == "cycles":
+		if request.Method != "GET" {
+			writer.Header().Set("Allow", "GET")
+			sendError(writer, 405, "method %s not allowed", request.Method)
+			return
+		}
+		cycleHandler(writer, request, gr, parts[2])
+	case len(parts) == 2:
+		resourceHandler(writer, request, gr, parts[1])
+	default:
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
+	}
+}
+
+// The current grid of a run.
+type XBoard struct {
+	Name       string `json:"name" xml:"Name"`
+	Cycle      int    `json:"cycle" xml:"Cycle"` // cycles played
+	Width      int    `json:"width" xml:"Width"`
+	Height     int    `json:"height" xml:"Height"`
+	Population int    `json:"population" xml:"Population"`
+	RLE        string `json:"rle" xml:"RLE"`
+}
+
+// Make the client form of a run's current grid.
+func makeReturnedBoard(gr *GameRun) (xb *XBoard) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	grid := gr.CurrentGrid
+	xb = &XBoard{Name: gr.Name, Cycle: len(gr.Cycles), Width: grid.Width,
+		Height: grid.Height, RLE: FormatRLE(grid, gr.Rule)}
+	for _, b := range grid.Data {
+		xb.Population += int(b)
+	}
+	return
+}
+
+// Board, edits, continue and events request handler.
+func resourceHandler(writer http.ResponseWriter, request *http.Request, gr *GameRun, resource string) {
+	if resource == "pin" {
+		pinHandler(writer, request, gr)
+		return
+	}
+	methods := map[string]string{"board": "GET", "edits": "POST", "continue": "POST",
+		"rewind": "POST", "fork": "POST", "events": "GET"}
+	method, ok := methods[resource]
+	if !ok {
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
+		return
+	}
+	if request.Method != method {
+		writer.Header().Set("Allow", method)
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	offers := []string{jsonType, xmlType}
+	switch resource {
+	case "board":
+		offers = append(offers, pngType, rleType)
+	case "fork":
+		offers = runTypes
+	}
+	ct, ok := negotiate(request, offers...)
+	if !ok {
+		sendError(writer, 406, "supported types: %s", strings.Join(offers, ", "))
+		return
+	}
+	var err error
+	switch resource {
+	case "board":
+		switch ct {
+		case pngType:
+			var buf bytes.Buffer
+			gr.lock.Lock()
+			err = renderGrid(gr.CurrentGrid).MakePNG(&buf, 0)
+			gr.lock.Unlock()
+			if err != nil {
+				sendError(writer, 500, "cannot make image: %v", err)
+				return
+			}
+			writer.Header().Set("Content-Type", pngType)
+			writer.Write(buf.Bytes()) // send response; error ignored
+		case rleType:
+			writer.Header().Set("Content-Type", rleType)
+			writer.Write([]byte(makeReturnedBoard(gr).RLE)) // send response; error ignored
+		default:
+			sendValue(writer, 200, ct, makeReturnedBoard(gr))
+		}
+		return
+	case "events":
+		gr.lock.Lock()
+		events := makeReturnedEvents(gr)
+		gr.lock.Unlock()
+		sendValue(writer, 200, ct, &XRunEventList{Events: events})
+		return
+	case "edits":
+		var edits []*XEdit
+		edits, err = readEdits(writer, request)
+		if err != nil {
+			sendError(writer, bodyErrorStatus(err), "bad edits: %v", err)
+			return
+		}
+		err = gr.Edit(edits)
+	case "continue":
+		cycles := 1
+		if xc := request.URL.Query().Get("cycles"); len(xc) > 0 {
+			if cycles, err = strconv.Atoi(xc); err != nil || cycles < 1 {
+				sendError(writer, 400, "bad cycles %q", xc)
+				return
+			}
+		}
+		width, height, _ := gr.size()
+		done, status, xerr := requestUser(request).admit(int64(width) * int64(height) * int64(cycles))
+		if xerr != nil {
+			sendError(writer, status, "%v", xerr)
+			return
+		}
+		err = gr.Continue(request.Context(), cycles)
+		if err == nil {
+			width, height, _ = gr.size()
+			done(int64(width) * int64(height) * int64(cycles))
+			gr.Parent.Retain()
+		} else {
+			done(0)
+		}
+	case "rewind":
+		xc := request.URL.Query().Get("cycle")
+		cycle, xerr := strconv.Atoi(xc)
+		if xerr != nil {
+			sendError(writer, 400, "bad cycle %q", xc)
+			return
+		}
+		err = gr.Rewind(cycle)
+	case "fork":
+		forkHandler(writer, request, gr, ct)
+		return
+	}
+	switch {
+	case errors.Is(err, BadEditError) || errors.Is(err, OffBoardError) ||
+		errors.Is(err, TooManyCyclesError) || errors.Is(err, BadIndexError):
+		sendError(writer, 400, "%v", err)
+	case errors.Is(err, RunBusyError):
+		sendError(writer, 409, "%v; try again when it is done", err)
+	case errors.Is(err, QueueFullError):
+		sendError(writer, 503, "%v", err)
+	case err != nil:
+		sendError(writer, 422, "%v", err)
+	default:
+		sendValue(writer, 200, ct, makeReturnedBoard(gr))
+	}
+}
+
+// Pin or unpin a run so retention limits never evict it.
+//
+//	PUT    /runs/{name}/pin  pin
+//	DELETE /runs/{name}/pin  unpin
+func pinHandler(writer http.ResponseWriter, request *http.Request, gr *GameRun) {
+	switch request.Method {
+	case "PUT", "DELETE":
+		if !gr.Parent.Pin(gr.Name, request.Method == "PUT") {
+			sendError(writer, 404, "run %q not found", gr.Name)
+			return
+		}
+		writer.WriteHeader(204)
+	default:
+		writer.Header().Set("Allow", "PUT, DELETE")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+	}
+}
+
+// Fork a run into a new run.
+func forkHandler(writer http.ResponseWriter, request *http.Request, parent *GameRun, ct string) {
+	var err error
+	defer func() {
+		observeRunOutcome("fork", err)
+	}()
+	fr := &XForkRequest{}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body,
+		MaxSeedBytes+maxFormOverhead))
+	if err == nil {
+		err = json.Unmarshal(body, fr)
+	}
+	if err != nil {
+		sendError(writer, bodyErrorStatus(err), "bad fork request: %v", err)
+		return
+	}
+	switch {
+	case len(fr.Name) == 0 || strings.Contains(fr.Name, "/"):
+		err = fmt.Errorf("a name without '/' is required")
+	case fr.Cycles < 0 || fr.Goroutines < 0:
+		err = fmt.Errorf("cycles and goroutines cannot be negative")
+	}
+	if err != nil {
+		sendError(writer, 400, "%v", err)
+		return
+	}
+	game := requestGame(request)
+	if _, exists := game.GetRun(fr.Name); exists {
+		err = fmt.Errorf("run %q already exists", fr.Name)
+		sendError(writer, 409, "%v", err)
+		return
+	}
+	_, _, cycle := parent.size()
+	if fr.Cycle != nil {
+		cycle = *fr.Cycle
+	}
+	params := RunParams{Cycles: fr.Cycles, Goroutines: fr.Goroutines, AutoTune: fr.AutoTune, Rule: fr.Rule,
+		Kernel: fr.Kernel, Topology: fr.Topology, Pinned: fr.Pinned, Priority: fr.Priority,
+		Context: request.Context()}
+	if err = params.Check(); err != nil {
+		sendError(writer, 400, "%v", err)
+		return
+	}
+	if status, xerr := checkPriority(request, fr.Priority); xerr != nil {
+		sendError(writer, status, "%v", xerr)
+		return
+	}
+	var done func(int64)
+	var status int
+	params.Admit = requestUser(request).runAdmitter("fork", &done, &status)
+	gr, err := game.Fork(parent, cycle, fr.Name, params, fr.Edits)
+	switch {
+	case done == nil: // not admitted
+	case gr != nil:
+		done(gr.cellCycles())
+	default:
+		done(0)
+	}
+	switch {
+	case errors.Is(err, QuotaError):
+		sendError(writer, status, "%v", err)
+	case errors.Is(err, BadEditError) || errors.Is(err, OffBoardError) ||
+		errors.Is(err, BadIndexError) || errors.Is(err, BadRuleError) ||
+		errors.Is(err, UnknownKernelError):
+		sendError(writer, 400, "%v", err)
+	case errors.Is(err, QueueFullError):
+		sendError(writer, 503, "%v", err)
+	case err != nil:
+		sendError(writer, 422, "cannot fork: %v", err)
+	default:
+		writer.Header().Set("Location", "/runs/"+gr.Name)
+		sendValue(writer, 201, ct, makeReturnedRun(gr))
+	}
+}
+
+// Read a JSON edit or list of edits.
+func readEdits(writer http.ResponseWriter, request *http.Request) (edits []*XEdit, err error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body,
+		MaxSeedBytes+maxFormOverhead))
+	if err != nil {
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &edits)
+	} else {
+		e := &XEdit{}
+		err = json.Unmarshal(body, e)
+		edits = []*XEdit{e}
+	}
+	if err == nil && len(edits) == 0 {
+		err = errors.New("no edits")
+	}
+	return
+}
+
+// Send one cycle of a run; cycle 0 is the initial grid.
+func cycleHandler(writer http.ResponseWriter, request *http.Request, gr *GameRun, xn string) {
+	_, _, cycles := gr.size()
+	n, err := strconv.Atoi(xn)
+	if err != nil || n < 0 || n > cycles {
+		sendError(writer, 404, "cycle %q not found; run has %d cycles", xn, cycles)
+		return
+	}
+	ct, ok := negotiate(request, jsonType, xmlType, pngType, rleType)
+	if !ok {
+		sendError(writer, 406, "supported types: %s, %s, %s, %s", jsonType, xmlType, pngType, rleType)
+		return
+	}
+	switch ct {
+	case pngType:
+		var buf bytes.Buffer
+		err = gr.MakePNG(&buf, n)
+		switch {
+		case errors.Is(err, BadIndexError): // rewound since checked
+			sendError(writer, 404, "cycle %d not found", n)
+			return
+		case err != nil:
+			sendError(writer, 500, "cannot make image: %v", err)
+			return
+		}
+		writer.Header().Set("Content-Type", pngType)
+		writer.Write(buf.Bytes()) // send response; error ignored
+		return
+	case rleType:
+		gr.lock.Lock()
+		grid, err := gr.GridAt(n)
+		gr.lock.Unlock()
+		if err != nil {
+			sendError(writer, 404, "%v", err)
+			return
+		}
+		writer.Header().Set("Content-Type", rleType)
+		writer.Write([]byte(FormatRLE(grid, gr.Rule))) // send response; error ignored
+		return
+	}
+	var xc *XGameCycle
+	gr.lock.Lock()
+	switch {
+	case n == 0:
+		xc = &XGameCycle{Cycle: 0, MaxCycles: gr.MaxCycles, GorountineCount: gr.GoroutineCount,
+			Checksum: formatChecksum(gr.InitialGrid.Checksum()), Population: gridPopulation(gr.InitialGrid)}
+	case n <= len(gr.Cycles): // may have been rewound since checked
+		xc = makeReturnedCycle(gr.Cycles[n-1])
+	}
+	gr.lock.Unlock()
+	if xc == nil {
+		sendError(writer, 404, "cycle %d not found", n)
+		return
+	}
+	sendValue(writer, 200, ct, xc)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCycleHandlerDuringRewind(t *testing.T) {
+	g := &Game{Runs: make(map[string]*GameRun), MaxCycles: 20, Quiet: true}
+	grid, err := ParseRLE("x = 8, y = 8\n3o!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := g.RunGrid("a", "test", grid, RunParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, format := range []string{jsonType, pngType, rleType} {
+		wg.Add(1)
+		go func(format string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				request := httptest.NewRequest("GET", "/runs/a/cycles/20", nil)
+				request.Header.Set("Accept", format)
+				recorder := httptest.NewRecorder()
+				cycleHandler(recorder, request, gr, "20")
+				if recorder.Code != 200 && recorder.Code != 404 {
+					t.Errorf("%s: got %d: %s", format, recorder.Code, recorder.Body.String())
+				}
+			}
+		}(format)
+	}
+	for i := 0; i < 2000; i++ {
+		if err = gr.Rewind(19); err != nil {
+			t.Fatal(err)
+		}
+		if err = gr.Continue(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Restricts what LoadImage (and so seed loading) may read.
+type LoadPolicy struct {
+	FileRoot       string        // "file:" paths must be under this; "" disables files
+	AllowedSchemes []string      // URL schemes allowed (ex. "http", "https", "file")
+	AllowedHosts   []string      // hosts allowed; "*.x.com" matches subdomains; empty allows any
+	DenyPrivate    bool          // reject loopback, private, link-local, etc. addresses
+	DeniedNets     []*net.IPNet  // additional denied address ranges
+	MaxBytes       int64         // maximum download (or file) size
+	Timeout        time.Duration // total time allowed for a download
+	MaxRedirects   int
+	clientOnce     sync.Once
+	httpClient     *http.Client // made on first download, then reused
+}
+
+// How long an idle download connection is kept for reuse.
+const idleLoadTimeout = 90 * time.Second
+
+// Policy used when loading images and seeds.
+var CurrentPolicy = &LoadPolicy{
+	FileRoot:       "", // servers read no files unless configured
+	AllowedSchemes: []string{"http", "https", "file"},
+	DenyPrivate:    true,
+	MaxBytes:       MaxSeedBytes,
+	Timeout:        10 * time.Second,
+	MaxRedirects:   5,
+}
+
+// Error values.
+var (
+	SchemeNotAllowedError  = errors.New("scheme not allowed")
+	HostNotAllowedError    = errors.New("host not allowed")
+	AddressNotAllowedError = errors.New("address not allowed")
+	PathNotAllowedError    = errors.New("path outside file root")
+)
+
+// Open a URL as allowed by the policy.
+// The caller must close the returned reader.
+func (p *LoadPolicy) Open(url string) (r io.ReadCloser, err error) {
+	if strings.HasPrefix(url, FilePrefix) {
+		if err = p.checkScheme("file"); err != nil {
+			return
+		}
+		var path string
+		path, err = p.ResolvePath(url[len(FilePrefix):])
+		if err != nil {
+			return
+		}
+		r, err = os.Open(path) // read from file
+		return
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return
+	}
+	if err = p.checkURL(u); err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		cancel()
+		return
+	}
+	resp, err := p.client().Do(req) // get from network
+	if err != nil {
+		cancel()
+		return
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close() // error ignored
+		cancel()
+		err = fmt.Errorf("get %s: %s", url, resp.Status)
+		return
+	}
+	if resp.ContentLength > p.MaxBytes {
+		resp.Body.Close() // error ignored
+		cancel()
+		err = SeedTooLargeError
+		return
+	}
+	r = &cancelReadCloser{resp.Body, cancel}
+	return
+}
+
+// Read all of a URL as allowed by the policy.
+func (p *LoadPolicy) ReadAll(url string) (b []byte, err error) {
+	r, err := p.Open(url)
+	if err != nil {
+		return
+	}
+	defer r.Close() // error ignored
+	b, err = ioutil.ReadAll(io.LimitReader(r, p.MaxBytes+1))
+	if err == nil && int64(len(b)) > p.MaxBytes {
+		err = SeedTooLargeError
+	}
+	return
+}
+
+// Resolve a file path against the file root.
+// Relative paths are relative to the root; absolute paths (after following
+// symbolic links) must be within it.
+func (p *LoadPolicy) ResolvePath(path string) (resolved string, err error) {
+	if len(p.FileRoot) == 0 {
+		err = fmt.Errorf("%w: file access disabled", PathNotAllowedError)
+		return
+	}
+	root, err := filepath.Abs(p.FileRoot)
+	if err != nil {
+		return
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err = filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("%w: %s", PathNotAllowedError, path)
+	}
+	return
+}
+
+func (p *LoadPolicy) checkScheme(scheme string) (err error) {
+	for _, s := range p.AllowedSchemes {
+		if strings.EqualFold(s, scheme) {
+			return
+		}
+	}
+	return fmt.Errorf("%w: %q", SchemeNotAllowedError, scheme)
+}
+
+// Check a network URL's scheme and host (not its addresses).
+func (p *LoadPolicy) checkURL(u *neturl.URL) (err error) {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("%w: %q", SchemeNotAllowedError, u.Scheme)
+	}
+	if err = p.checkScheme(scheme); err != nil {
+		return
+	}
+	if len(p.AllowedHosts) == 0 {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range p.AllowedHosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return
+		}
+	}
+	return fmt.Errorf("%w: %q", HostNotAllowedError, host)
+}
+
+// Check an address actually connected to (so after name resolution).
+func (p *LoadPolicy) checkIP(ip net.IP) (err error) {
+	if p.DenyPrivate && (ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()) {
+		return fmt.Errorf("%w: %v", AddressNotAllowedError, ip)
+	}
+	for _, n := range p.DeniedNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("%w: %v", AddressNotAllowedError, ip)
+		}
+	}
+	return
+}
+
+// Get the HTTP client that enforces the policy on every connection and
+// redirect; one per policy so connections are reused.
+func (p *LoadPolicy) client() *http.Client {
+	p.clientOnce.Do(func() {
+		p.httpClient = p.newClient()
+	})
+	return p.httpClient
+}
+
+// Make an HTTP client that enforces the policy.
+func (p *LoadPolicy) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: p.Timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", AddressNotAllowedError, host)
+			}
+			return p.checkIP(ip)
+		},
+	}
+	return &http.Client{
+		Timeout: p.Timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   p.Timeout,
+			ResponseHeaderTimeout: p.Timeout,
+			IdleConnTimeout:       idleLoadTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > p.MaxRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			return p.checkURL(req.URL)
+		},
+	}
+}
+
+// Parse a comma separated list of CIDR ranges.
+func ParseNets(list string) (nets []*net.IPNet, err error) {
+	for _, part := range splitList(list) {
+		var n *net.IPNet
+		_, n, err = net.ParseCIDR(part)
+		if err != nil {
+			return
+		}
+		nets = append(nets, n)
+	}
+	return
+}
+
+// Split a comma separated list, dropping empty items.
+func splitList(list string) (items []string) {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// Cancels a request context when its body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() (err error) {
+	err = c.ReadCloser.Close()
+	c.cancel()
+	return
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run scheduling.
+// The server plays runs through a scheduler so concurrent runs do not
+// oversubscribe the CPU. Running runs share a limit on worker goroutines
+// (a run gets at most the limit); runs that do not fit wait in a bounded
+// queue. Waiting runs start by priority, then (for fair sharing) the owner
+// (user) with the fewest worker goroutines in use, then arrival. The head
+// of the queue is never skipped, so large runs are not starved. Runs
+// report their state, queue position and wait time.
+
+// Run priorities.
+const (
+	LowPriority    = "low"
+	NormalPriority = "normal"
+	HighPriority   = "high" // admins only
+)
+
+// Priorities in increasing order.
+var Priorities = []string{LowPriority, NormalPriority, HighPriority}
+
+// Run states.
+const (
+	queuedState  = "queued"
+	runningState = "running"
+	doneState    = "done"
+)
+
+// Error values.
+var (
+	QueueFullError   = errors.New("run queue is full")
+	BadPriorityError = errors.New("unknown priority")
+)
+
+// The server's scheduler; nil (no scheduling) outside the server.
+var RunScheduler *Scheduler
+
+// Schedules runs within a worker goroutine limit.
+type Scheduler struct {
+	lock     sync.Mutex
+	workers  int           // limit on goroutines of running runs
+	maxQueue int           // limit on waiting runs
+	busy     int           // goroutines granted
+	byOwner  map[*Game]int // goroutines granted by owner
+	queue    []*ticket     // waiting runs
+	tickets  map[*GameRun]*ticket
+	sequence int64
+}
+
+// A run's place in the queue.
+type ticket struct {
+	gr       *GameRun
+	owner    *Game
+	priority int
+	want     int // goroutines; those granted once started
+	sequence int64
+	granted  chan struct{} // closed when the run may start
+}
+
+// Make a scheduler.
+func NewScheduler(workers, maxQueue int) (s *Scheduler) {
+	s = &Scheduler{byOwner: make(map[*Game]int), tickets: make(map[*GameRun]*ticket)}
+	s.SetLimits(workers, maxQueue)
+	return
+}
+
+// Change the limits; waiting runs start if they now fit.
+func (s *Scheduler) SetLimits(workers, maxQueue int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.workers, s.maxQueue = workers, maxQueue
+	s.dispatch()
+}
+
+// Get a priority by name; empty is normal.
+func ParsePriority(name string) (priority string, err error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return NormalPriority, nil
+	}
+	for _, p := range Priorities {
+		if name == p {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q; known: %v", BadPriorityError, name, Priorities)
+}
+
+// Check a requested priority; only admins may use high priority.
+func checkPriority(request *http.Request, priority string) (status int, err error) {
+	if priority, err = ParsePriority(priority); err != nil {
+		return 400, err
+	}
+	if priority == HighPriority && !requestIsAdmin(request) {
+		return 403, fmt.Errorf("only admins can use %s priority", HighPriority)
+	}
+	return
+}
+
+func priorityRank(priority string) int {
+	for i, p := range Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 1 // normal
+}
+
+// Queue a run (of an owner); fails if the queue is full.
+func (s *Scheduler) enqueue(gr *GameRun, owner *Game) (t *ticket, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.queue) >= s.maxQueue {
+		return nil, fmt.Errorf("%w (%d runs waiting)", QueueFullError, s.maxQueue)
+	}
+	s.sequence++
+	t = &ticket{gr: gr, owner: owner, priority: priorityRank(gr.Priority),
+		want: gr.GoroutineCount, sequence: s.sequence, granted: make(chan struct{})}
+	if t.want < 1 {
+		t.want = 1
+	}
+	s.queue = append(s.queue, t)
+	s.tickets[gr] = t
+	gr.setState(queuedState)
+	s.dispatch()
+	return
+}
+
+// Wait for a queued run to be granted worker goroutines (or the context
+// to end, which dequeues it). The caller must call release when done.
+func (s *Scheduler) wait(ctx context.Context, t *ticket) (release func(), err error) {
+	select {
+	case <-t.granted:
+	case <-ctx.Done():
+		s.lock.Lock()
+		select {
+		case <-t.granted: // granted meanwhile
+			s.lock.Unlock()
+		default:
+			s.remove(t)
+			s.lock.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.busy -= t.want
+		s.byOwner[t.owner] -= t.want
+		if s.byOwner[t.owner] <= 0 {
+			delete(s.byOwner, t.owner)
+		}
+		s.dispatch()
+	}
+	return
+}
+
+// Remove a ticket from the queue.
+func (s *Scheduler) remove(t *ticket) {
+	for i, q := range s.queue {
+		if q == t {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	delete(s.tickets, t.gr)
+}
+
+// Order the queue: the next run to start first.
+func (s *Scheduler) sortQueue() {
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		a, b := s.queue[i], s.queue[j]
+		switch {
+		case a.priority != b.priority:
+			return a.priority > b.priority
+		case s.byOwner[a.owner] != s.byOwner[b.owner]:
+			return s.byOwner[a.owner] < s.byOwner[b.owner]
+		}
+		return a.sequence < b.sequence
+	})
+}
+
+// Start waiting runs while they fit.
+func (s *Scheduler) dispatch() {
+	for len(s.queue) > 0 {
+		s.sortQueue()
+		t := s.queue[0]
+		if t.want > s.workers {
+			t.want = s.workers
+		}
+		if s.busy > 0 && s.busy+t.want > s.workers {
+			return
+		}
+		s.remove(t)
+		s.busy += t.want
+		s.byOwner[t.owner] += t.want
+		t.gr.granted = t.want
+		t.gr.setState(runningState)
+		close(t.granted)
+	}
+}
+
+// Get a waiting run's position in the queue (1 is next); 0 if not queued.
+func (s *Scheduler) Position(gr *GameRun) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.tickets[gr]; !ok {
+		return 0
+	}
+	s.sortQueue()
+	for i, t := range s.queue {
+		if t.gr == gr {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Get the number of waiting runs and goroutines in use.
+func (s *Scheduler) Load() (queued, busy int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.queue), s.busy
+}
+
+// Queue a run of the game with the scheduler (if any). Call start to wait
+// until the run may play and done when it has played.
+func (g *Game) schedule(gr *GameRun) (start func(ctx context.Context) (done func(), err error), err error) {
+	s := RunScheduler
+	if s == nil {
+		gr.granted = 0
+		return func(context.Context) (func(), error) { return func() {}, nil }, nil
+	}
+	t, err := s.enqueue(gr, g)
+	if err != nil {
+		return
+	}
+	start = func(ctx context.Context) (done func(), err error) {
+		release, err := s.wait(ctx, t)
+		if err != nil {
+			gr.setState(doneState) // as before it was queued
+			return
+		}
+		done = func() {
+			release()
+			gr.setState(doneState)
+		}
+		return
+	}
+	return
+}
+
+// Record a run's state; queuing also records the time.
+func (gr *GameRun) setState(state string) {
+	gr.stateLock.Lock()
+	defer gr.stateLock.Unlock()
+	now := time.Now()
+	switch state {
+	case queuedState:
+		gr.QueuedAt = now
+	case runningState:
+		wait := now.Sub(gr.QueuedAt)
+		gr.Wait += wait
+		queueSeconds.Observe(wait.Seconds())
+	}
+	gr.State = state
+}
+
+// Get a run's state and total time waiting to be scheduled (so far).
+func (gr *GameRun) status() (state string, wait time.Duration) {
+	gr.stateLock.Lock()
+	defer gr.stateLock.Unlock()
+	state, wait = gr.State, gr.Wait
+	if state == queuedState {
+		wait += time.Since(gr.QueuedAt)
+	}
+	return
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newScheduledRun(goroutines int, priority string) *GameRun {
+	return &GameRun{GoroutineCount: goroutines, Priority: priority}
+}
+
+// Report if a ticket's run may start.
+func started(t *ticket) bool {
+	select {
+	case <-t.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait for a started run to be granted and release it.
+func finish(tb testing.TB, s *Scheduler, t *ticket) {
+	release, err := s.wait(context.Background(), t)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	release()
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	s := NewScheduler(4, 2)
+	owner := &Game{}
+	big, err := s.enqueue(newScheduledRun(8, NormalPriority), owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !started(big) || big.gr.granted != 4 {
+		t.Fatalf("a run wanting 8 of 4 workers: started %v with %d", started(big), big.gr.granted)
+	}
+	a, _ := s.enqueue(newScheduledRun(1, NormalPriority), owner)
+	b, _ := s.enqueue(newScheduledRun(3, NormalPriority), owner)
+	if started(a) || started(b) {
+		t.Fatalf("runs started over the worker limit")
+	}
+	if _, err = s.enqueue(newScheduledRun(1, NormalPriority), owner); !errors.Is(err, QueueFullError) {
+		t.Errorf("got %v queuing a third run, want %v", err, QueueFullError)
+	}
+	if queued, busy := s.Load(); queued != 2 || busy != 4 {
+		t.Errorf("got %d queued and %d busy, want 2 and 4", queued, busy)
+	}
+	if state, _ := a.gr.status(); state != queuedState {
+		t.Errorf("got state %q, want %q", state, queuedState)
+	}
+	finish(t, s, big)
+	if !started(a) || !started(b) {
+		t.Fatalf("runs fitting the freed workers did not start")
+	}
+	if queued, busy := s.Load(); queued != 0 || busy != 4 {
+		t.Errorf("got %d queued and %d busy, want 0 and 4", queued, busy)
+	}
+	finish(t, s, a)
+	finish(t, s, b)
+	if _, busy := s.Load(); busy != 0 {
+		t.Errorf("got %d busy after every run finished", busy)
+	}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	s := NewScheduler(2, 10)
+	alice, bob := &Game{}, &Game{}
+	a1, _ := s.enqueue(newScheduledRun(1, NormalPriority), alice)
+	b1, _ := s.enqueue(newScheduledRun(1, NormalPriority), bob)
+	a2, _ := s.enqueue(newScheduledRun(1, NormalPriority), alice)
+	low, _ := s.enqueue(newScheduledRun(1, LowPriority), bob)
+	b2, _ := s.enqueue(newScheduledRun(1, NormalPriority), bob)
+	high, _ := s.enqueue(newScheduledRun(1, HighPriority), bob)
+	if !started(a1) || !started(b1) {
+		t.Fatalf("first runs did not start")
+	}
+	// by priority, then the owner with fewer workers, then arrival
+	for i, want := range []*ticket{high, a2, b2, low} {
+		if got := s.Position(want.gr); got != i+1 {
+			t.Errorf("run %d: got position %d, want %d", i+1, got, i+1)
+		}
+	}
+	finish(t, s, a1)
+	if !started(high) {
+		t.Fatalf("high priority run did not start first")
+	}
+	finish(t, s, b1) // bob has high running; alice has none
+	if !started(a2) || started(b2) {
+		t.Fatalf("run of the owner with fewer workers did not start first")
+	}
+	finish(t, s, high)
+	finish(t, s, a2)
+	if !started(b2) || !started(low) {
+		t.Fatalf("remaining runs did not start")
+	}
+	if s.Position(low.gr) != 0 {
+		t.Errorf("started run still has a queue position")
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := NewScheduler(1, 10)
+	owner := &Game{}
+	first, _ := s.enqueue(newScheduledRun(1, NormalPriority), owner)
+	waiting, _ := s.enqueue(newScheduledRun(1, NormalPriority), owner)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.wait(ctx, waiting); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if queued, _ := s.Load(); queued != 0 || s.Position(waiting.gr) != 0 {
+		t.Errorf("cancelled run is still queued")
+	}
+	finish(t, s, first)
+	if started(waiting) {
+		t.Errorf("cancelled run started")
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for name, want := range map[string]string{"": NormalPriority, " High ": HighPriority,
+		"low": LowPriority} {
+		if got, err := ParsePriority(name); err != nil || got != want {
+			t.Errorf("%q: got %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParsePriority("urgent"); !errors.Is(err, BadPriorityError) {
+		t.Errorf("got %v, want %v", err, BadPriorityError)
+	}
+}
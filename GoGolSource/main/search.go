@@ -0,0 +1,781 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batch soup search (in the style of apgsearch).
+// Random soups are run, each on a board with a dead margin, until they
+// stabilize (the board repeats). Spaceships that reach the edge of the
+// board are taken off and classified as they escape; if anything else
+// reaches the edge the soup needs a larger margin and is reported (as
+// overflowed) rather than counted. The final board is split
+// into objects (live cells within 2 cells of each other), each object is
+// run alone to find its period and motion, and it is named by a canonical
+// code (the same under rotation, reflection and phase):
+//   xs<population>_<rle>  still life
+//   xp<period>_<rle>      oscillator
+//   xq<period>_<rle>      spaceship
+//   zz_unknown            anything else (ex. a gun or chaotic debris)
+// The RLE is of the least phase and orientation. The codes of known objects
+// (under B3/S23) have names; soups with rare or unknown objects are listed
+// (and optionally saved) for replay.
+
+// Search settings.
+type SearchConfig struct {
+	Soups       int     // soups to run
+	Workers     int     // soups run at once
+	Width       int     // soup size
+	Height      int     //
+	Density     float64 //
+	Symmetry    string  //
+	FirstSeed   int64   // soups use FirstSeed, FirstSeed+1, ...
+	Margin      int     // dead cells around each soup
+	Generations int     // maximum generations per soup
+	Rule        *Rule
+	SaveDir     string // if set, rare soups are saved here as RLE
+	Out         io.Writer
+}
+
+// Search limits.
+const (
+	maxObjectPeriod = 64 // longest period classified (and detected when stabilizing)
+	escapeBand      = 2  // objects this close to the board edge are escaping
+	searchTileSize  = 8  // small, as few cells of a board are alive
+	unknownCode     = "zz_unknown"
+)
+
+// Object kinds.
+const (
+	stillLifeKind  = "still life"
+	oscillatorKind = "oscillator"
+	spaceshipKind  = "spaceship"
+	unknownKind    = "unknown"
+)
+
+// A classified object.
+type searchObject struct {
+	Code   string
+	Kind   string
+	Period int
+}
+
+// The result of one soup.
+type XSoupResult struct {
+	Seed        int64    `json:"seed"`
+	Source      string   `json:"source"` // random: URL that replays the soup
+	Generations int      `json:"generations"`
+	Stabilized  bool     `json:"stabilized"`
+	Overflowed  bool     `json:"overflowed,omitempty"` // reached the board edge
+	Codes       []string `json:"codes"`                // rare or unknown objects
+	File        string   `json:"file,omitempty"`       // if saved
+}
+
+// The count of one kind of object.
+type XCensusEntry struct {
+	Code      string `json:"code"`
+	Name      string `json:"name,omitempty"`
+	Kind      string `json:"kind"`
+	Period    int    `json:"period,omitempty"`
+	Count     int    `json:"count"`
+	Soups     int    `json:"soups"`     // soups with at least one
+	FirstSeed int64  `json:"firstSeed"` // first soup (by seed) with one
+	Rare      bool   `json:"rare"`
+}
+
+// A census of all soups searched.
+type XCensus struct {
+	Rule         string          `json:"rule"`
+	Width        int             `json:"width"`
+	Height       int             `json:"height"`
+	Density      float64         `json:"density"`
+	Symmetry     string          `json:"symmetry,omitempty"`
+	FirstSeed    int64           `json:"firstSeed"`
+	Soups        int             `json:"soups"`
+	Stabilized   int             `json:"stabilized"`
+	Unstabilized int             `json:"unstabilized"` // including overflowed
+	Overflowed   int             `json:"overflowed"`
+	Objects      int             `json:"objects"`
+	Duration     int64           `json:"durationMS"`
+	Census       []*XCensusEntry `json:"census"` // most common first
+	Rare         []*XSoupResult  `json:"rareSoups"`
+}
+
+// Known objects (under B3/S23); common ones are not rare.
+var knownObjects = []struct {
+	name, rle string
+	common    bool
+}{
+	{"block", "2o$2o!", true},
+	{"beehive", "b2o$o2bo$b2o!", true},
+	{"loaf", "b2o$o2bo$bobo$2bo!", true},
+	{"boat", "2o$obo$bo!", true},
+	{"tub", "bo$obo$bo!", true},
+	{"ship", "2o$obo$b2o!", true},
+	{"pond", "b2o$o2bo$o2bo$b2o!", true},
+	{"blinker", "3o!", true},
+	{"glider", "bob$2bo$3o!", true},
+	{"long boat", "2o$obo$bobo$2bo!", false},
+	{"barge", "bo$obo$bobo$2bo!", false},
+	{"snake", "2obo$ob2o!", false},
+	{"aircraft carrier", "2o$o2bo$2b2o!", false},
+	{"eater 1", "2o$obo$2bo$2b2o!", false},
+	{"mango", "b2o$o2bo$bo2bo$2b2o!", false},
+	{"long ship", "2o$obo$bobo$2b2o!", false},
+	{"integral sign", "2o$obo$2bo$2bobo$3b2o!", false},
+	{"toad", "b3o$3o!", false},
+	{"beacon", "2o$2o$2b2o$2b2o!", false},
+	{"clock", "2bo$obo$bobo$bo!", false},
+	{"pulsar", "2b3o3b3o2$o4bobo4bo$o4bobo4bo$o4bobo4bo$2b3o3b3o2$2b3o3b3o$o4bobo4bo$" +
+		"o4bobo4bo$o4bobo4bo2$2b3o3b3o!", false},
+	{"pentadecathlon", "2bo4bo$2ob4ob2o$2bo4bo!", false},
+	{"lightweight spaceship", "bo2bo$o$o3bo$4o!", false},
+	{"middleweight spaceship", "3bo$bo3bo$o$o4bo$5o!", false},
+	{"heavyweight spaceship", "3b2o$bo4bo$o$o5bo$6o!", false},
+}
+
+var (
+	knownOnce  sync.Once
+	knownNames map[string]string // by code
+	commonCode map[string]bool
+)
+
+// Classify the known objects (once) to get their codes.
+func loadKnownObjects() {
+	knownNames = make(map[string]string)
+	commonCode = make(map[string]bool)
+	g := &Game{Runs: make(map[string]*GameRun), Quiet: true}
+	for _, k := range knownObjects {
+		grid, err := ParseRLE("x = 16, y = 16\n" + k.rle)
+		fatalIfError(err)
+		var cells []cell
+		for y := 0; y < grid.Height; y++ {
+			for x := 0; x < grid.Width; x++ {
+				if grid.getCell(x, y) != 0 {
+					cells = append(cells, cell{x, y})
+				}
+			}
+		}
+		obj := classifyObject(g, cells, ConwayRule)
+		if obj.Code == unknownCode {
+			fatalIfError(fmt.Errorf("known object %s did not classify", k.name))
+		}
+		knownNames[obj.Code] = k.name
+		commonCode[obj.Code] = k.common
+	}
+}
+
+// Name an object code (under B3/S23), if known.
+func objectName(code string, rule *Rule) string {
+	if rule.String() != ConwayRule.String() {
+		return ""
+	}
+	knownOnce.Do(loadKnownObjects)
+	return knownNames[code]
+}
+
+// Report if an object is rare (not a common known object).
+func isRareObject(code string, rule *Rule) bool {
+	if len(objectName(code, rule)) == 0 {
+		return true
+	}
+	return !commonCode[code]
+}
+
+// Run the search.
+func RunSearch(sc *SearchConfig) (census *XCensus, err error) {
+	if err = checkSeedSize(sc.Width+2*sc.Margin, sc.Height+2*sc.Margin); err != nil {
+		return
+	}
+	if sc.SaveDir != "" {
+		if err = os.MkdirAll(sc.SaveDir, 0755); err != nil {
+			return
+		}
+	}
+	start := time.Now()
+	seeds := make(chan int64)
+	results := make(chan *soupOutcome)
+	var wg sync.WaitGroup
+	for i := 0; i < sc.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g := &Game{Runs: make(map[string]*GameRun), Quiet: true}
+			for seed := range seeds {
+				results <- runSoup(sc, g, seed)
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < sc.Soups; i++ {
+			seeds <- sc.FirstSeed + int64(i)
+		}
+		close(seeds)
+		wg.Wait()
+		close(results)
+	}()
+	var outcomes []*soupOutcome
+	for so := range results {
+		outcomes = append(outcomes, so)
+		if len(outcomes)%100 == 0 {
+			fmt.Fprintf(sc.Out, "%d soups searched...\n", len(outcomes))
+		}
+	}
+	sort.Slice(outcomes, func(i, j int) bool {
+		return outcomes[i].result.Seed < outcomes[j].result.Seed
+	})
+	census = makeCensus(sc, outcomes)
+	census.Duration = int64(time.Since(start) / time.Millisecond)
+	if sc.SaveDir != "" {
+		for _, r := range census.Rare {
+			if err = saveRareSoup(sc, r); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// What one soup produced.
+type soupOutcome struct {
+	result  *XSoupResult
+	objects []*searchObject
+}
+
+// Run one soup until it stabilizes, overflows (something other than a
+// spaceship reaches the edge) or reaches the generation limit.
+func runSoup(sc *SearchConfig, g *Game, seed int64) (so *soupOutcome) {
+	soup := &Soup{Width: sc.Width, Height: sc.Height, Density: sc.Density,
+		Seed: seed, Symmetry: sc.Symmetry}
+	so = &soupOutcome{result: &XSoupResult{Seed: seed, Source: soup.String(),
+		Codes: []string{}}}
+	gr := newSearchRun(g, soupBoard(soup, sc.Margin), sc.Rule)
+	seen := make(map[uint64]int) // generation by board hash
+	var hashes []uint64
+	for gen := 0; ; gen++ {
+		so.result.Generations = gen
+		escapees := removeEscapees(gr.CurrentGrid)
+		if len(escapees) > 0 {
+			gr.tiles = nil // the grid changed: recompute every tile
+		}
+		for _, cells := range escapees {
+			obj := classifyObject(g, cells, sc.Rule)
+			if obj.Kind != spaceshipKind {
+				so.result.Overflowed = true
+				break
+			}
+			so.addObject(obj, sc.Rule)
+		}
+		if so.result.Overflowed {
+			return
+		}
+		h := gridHash(gr.CurrentGrid)
+		if _, ok := seen[h]; ok {
+			so.result.Stabilized = true
+			break
+		}
+		seen[h] = gen
+		hashes = append(hashes, h)
+		if gen >= maxObjectPeriod {
+			delete(seen, hashes[gen-maxObjectPeriod])
+		}
+		if gen == sc.Generations {
+			return
+		}
+		stepRun(gr)
+	}
+	for _, group := range findObjects(gr.CurrentGrid) {
+		for _, cells := range splitObject(g, group, sc.Rule) {
+			so.addObject(classifyObject(g, cells, sc.Rule), sc.Rule)
+		}
+	}
+	return
+}
+
+// Record an object found in a soup.
+func (so *soupOutcome) addObject(obj *searchObject, rule *Rule) {
+	so.objects = append(so.objects, obj)
+	if isRareObject(obj.Code, rule) {
+		so.result.Codes = append(so.result.Codes, obj.Code)
+	}
+}
+
+// Place a soup in the middle of an empty board.
+func soupBoard(soup *Soup, margin int) (board *Grid) {
+	grid := soup.Grid()
+	board = NewEmptyGrid(grid.Width+2*margin, grid.Height+2*margin)
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			board.setCell(x+margin, y+margin, grid.getCell(x, y))
+		}
+	}
+	return
+}
+
+// Make a run to play a board for the search. The search needs no cycle
+// history, and most of a board is dead, so it uses the tiles kernel.
+func newSearchRun(g *Game, grid *Grid, rule *Rule) (gr *GameRun) {
+	gr = NewGameRunFromGrid("search", "search", grid, g)
+	gr.Rule, gr.GoroutineCount, gr.noHistory = rule, 1, true
+	gr.Kernel, gr.TileSize = TilesKernelName, searchTileSize
+	return
+}
+
+// Play one cycle (of a search run, so with a known kernel).
+func stepRun(gr *GameRun) {
+	fatalIfError(gr.NextCycle())
+}
+
+// Hash a grid's cells.
+func gridHash(grid *Grid) uint64 {
+	h := fnv.New64a()
+	h.Write(grid.Data) // cannot fail
+	return h.Sum64()
+}
+
+// Take the objects near the edge off a grid.
+func removeEscapees(grid *Grid) (groups [][]cell) {
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			edge := x < escapeBand || y < escapeBand ||
+				x >= grid.Width-escapeBand || y >= grid.Height-escapeBand
+			if !edge {
+				x = grid.Width - escapeBand - 1 // skip the interior
+				continue
+			}
+			if grid.getCell(x, y) != 0 {
+				groups = append(groups, takeObject(grid, x, y, 2))
+			}
+		}
+	}
+	return
+}
+
+// Split a grid into objects, removing them.
+func findObjects(grid *Grid) (groups [][]cell) {
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				groups = append(groups, takeObject(grid, x, y, 2))
+			}
+		}
+	}
+	return
+}
+
+// Remove (and return) the live cells within reach of a live cell, within
+// reach of those, and so on.
+func takeObject(grid *Grid, x, y, reach int) (cells []cell) {
+	grid.setCell(x, y, 0)
+	todo := []cell{{x, y}}
+	for len(todo) > 0 {
+		c := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		cells = append(cells, c)
+		for dy := -reach; dy <= reach; dy++ {
+			for dx := -reach; dx <= reach; dx++ {
+				if grid.getCell(c.x+dx, c.y+dy) != 0 {
+					grid.setCell(c.x+dx, c.y+dy, 0)
+					todo = append(todo, cell{c.x + dx, c.y + dy})
+				}
+			}
+		}
+	}
+	return
+}
+
+// Split a group of nearby cells into objects. The group's connected parts
+// are separate objects unless they interact: two parts interact if running
+// them together differs from running them apart.
+func splitObject(g *Game, cells []cell, rule *Rule) (groups [][]cell) {
+	grid, _, _ := objectGrid(cells)
+	var parts [][]cell
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				parts = append(parts, takeObject(grid, x, y, 1))
+			}
+		}
+	}
+	if len(parts) == 1 {
+		return [][]cell{cells}
+	}
+	joined := make([]int, len(parts)) // union-find parents
+	for i := range joined {
+		joined[i] = i
+	}
+	root := func(i int) int {
+		for joined[i] != i {
+			i = joined[i]
+		}
+		return i
+	}
+	for i := range parts {
+		for j := i + 1; j < len(parts); j++ {
+			if root(i) == root(j) || !nearby(parts[i], parts[j]) {
+				continue
+			}
+			if interacts(g, parts[i], parts[j], rule) {
+				joined[root(j)] = root(i)
+			}
+		}
+	}
+	byRoot := make(map[int]int) // group index by root
+	for i, part := range parts {
+		gi, ok := byRoot[root(i)]
+		if !ok {
+			gi = len(groups)
+			byRoot[root(i)] = gi
+			groups = append(groups, nil)
+		}
+		groups[gi] = append(groups[gi], part...)
+	}
+	return
+}
+
+// Report if any cells of two parts are within 2 cells of each other.
+func nearby(a, b []cell) bool {
+	for _, ca := range a {
+		for _, cb := range b {
+			if ca.x-cb.x <= 2 && cb.x-ca.x <= 2 && ca.y-cb.y <= 2 && cb.y-ca.y <= 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Report if two parts run differently together than apart.
+func interacts(g *Game, a, b []cell, rule *Rule) bool {
+	both, minX, minY := objectGrid(append(append([]cell{}, a...), b...))
+	var runs []*GameRun
+	for _, cells := range [][]cell{a, b} {
+		grid := NewEmptyGrid(both.Width, both.Height)
+		for _, c := range cells {
+			grid.setCell(c.x-minX, c.y-minY, 1)
+		}
+		runs = append(runs, newSearchRun(g, grid, rule))
+	}
+	run := newSearchRun(g, both, rule)
+	for t := 0; t < maxObjectPeriod; t++ {
+		for _, gr := range append(runs, run) {
+			stepRun(gr)
+		}
+		ga, gb, gab := runs[0].CurrentGrid, runs[1].CurrentGrid, run.CurrentGrid
+		for i := range gab.Data {
+			if gab.Data[i] != ga.Data[i]|gb.Data[i] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Make a grid of an object with room for it to run; minX and minY are the
+// object coordinates of the grid's 0, 0.
+func objectGrid(cells []cell) (grid *Grid, minX, minY int) {
+	pad := maxObjectPeriod/2 + escapeBand
+	minX, minY = cells[0].x, cells[0].y
+	maxX, maxY := minX, minY
+	for _, c := range cells {
+		minX, minY = minInt(minX, c.x), minInt(minY, c.y)
+		maxX, maxY = maxInt(maxX, c.x), maxInt(maxY, c.y)
+	}
+	minX, minY = minX-pad, minY-pad
+	grid = NewEmptyGrid(maxX-minX+1+pad, maxY-minY+1+pad)
+	for _, c := range cells {
+		grid.setCell(c.x-minX, c.y-minY, 1)
+	}
+	return
+}
+
+// Run an object alone to find its period and motion, and so its code.
+func classifyObject(g *Game, cells []cell, rule *Rule) (obj *searchObject) {
+	obj = &searchObject{Code: unknownCode, Kind: unknownKind}
+	grid, _, _ := objectGrid(cells)
+	gr := newSearchRun(g, grid, rule)
+	first, x0, y0, ok := cropGrid(gr.CurrentGrid)
+	if !ok {
+		return
+	}
+	phases := []*Grid{first}
+	for t := 1; t <= maxObjectPeriod; t++ {
+		stepRun(gr)
+		phase, x, y, ok := cropGrid(gr.CurrentGrid)
+		if !ok {
+			return // died or reached the edge
+		}
+		if !sameGrid(phase, first) {
+			phases = append(phases, phase)
+			continue
+		}
+		obj.Period = t
+		switch {
+		case x != x0 || y != y0:
+			obj.Kind = spaceshipKind
+			obj.Code = fmt.Sprintf("xq%d_%s", t, canonicalRLE(phases))
+		case t == 1:
+			obj.Kind = stillLifeKind
+			obj.Code = fmt.Sprintf("xs%d_%s", len(cells), canonicalRLE(phases))
+		default:
+			obj.Kind = oscillatorKind
+			obj.Code = fmt.Sprintf("xp%d_%s", t, canonicalRLE(phases))
+		}
+		return
+	}
+	return
+}
+
+// Crop a grid to its live cells; not ok if empty or touching the edge.
+func cropGrid(grid *Grid) (crop *Grid, x0, y0 int, ok bool) {
+	minX, minY, maxX, maxY := grid.Width, grid.Height, -1, -1
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				minX, minY = minInt(minX, x), minInt(minY, y)
+				maxX, maxY = maxInt(maxX, x), maxInt(maxY, y)
+			}
+		}
+	}
+	if maxX < 0 || minX == 0 || minY == 0 || maxX == grid.Width-1 || maxY == grid.Height-1 {
+		return
+	}
+	crop = NewEmptyGrid(maxX-minX+1, maxY-minY+1)
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			crop.setCell(x-minX, y-minY, grid.getCell(x, y))
+		}
+	}
+	return crop, minX, minY, true
+}
+
+func sameGrid(a, b *Grid) bool {
+	return a.Width == b.Width && a.Height == b.Height && string(a.Data) == string(b.Data)
+}
+
+// Get the least RLE (shortest, then alphabetically) of all phases in all
+// orientations.
+func canonicalRLE(phases []*Grid) (least string) {
+	for _, phase := range phases {
+		for t := 0; t < 8; t++ {
+			text := FormatRLE(TransformGrid(phase, t), ConwayRule)
+			text = strings.TrimSuffix(strings.SplitN(text, "\n", 2)[1], "!\n")
+			text = strings.ReplaceAll(text, "\n", "")
+			if len(least) == 0 || len(text) < len(least) ||
+				len(text) == len(least) && text < least {
+				least = text
+			}
+		}
+	}
+	return
+}
+
+// Rotate and reflect a grid: transforms 0 to 3 rotate by that many quarter
+// turns clockwise; 4 to 7 also reflect left to right first.
+func TransformGrid(grid *Grid, t int) (out *Grid) {
+	w, h := grid.Width, grid.Height
+	if t%2 == 1 {
+		out = NewEmptyGrid(h, w)
+	} else {
+		out = NewEmptyGrid(w, h)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := x
+			if t >= 4 {
+				sx = w - 1 - x
+			}
+			var nx, ny int
+			switch t % 4 {
+			case 0:
+				nx, ny = sx, y
+			case 1:
+				nx, ny = h-1-y, sx
+			case 2:
+				nx, ny = w-1-sx, h-1-y
+			case 3:
+				nx, ny = y, w-1-sx
+			}
+			out.setCell(nx, ny, grid.getCell(x, y))
+		}
+	}
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Count objects across soups.
+func makeCensus(sc *SearchConfig, outcomes []*soupOutcome) (census *XCensus) {
+	census = &XCensus{Rule: sc.Rule.String(), Width: sc.Width, Height: sc.Height,
+		Density: sc.Density, Symmetry: sc.Symmetry, FirstSeed: sc.FirstSeed,
+		Soups: len(outcomes), Census: []*XCensusEntry{}, Rare: []*XSoupResult{}}
+	entries := make(map[string]*XCensusEntry)
+	for _, so := range outcomes {
+		r := so.result
+		if r.Stabilized {
+			census.Stabilized++
+		} else {
+			census.Unstabilized++
+		}
+		if r.Overflowed {
+			census.Overflowed++
+		}
+		inSoup := make(map[string]bool)
+		for _, obj := range so.objects {
+			e, ok := entries[obj.Code]
+			if !ok {
+				e = &XCensusEntry{Code: obj.Code, Name: objectName(obj.Code, sc.Rule),
+					Kind: obj.Kind, Period: obj.Period, FirstSeed: r.Seed,
+					Rare: isRareObject(obj.Code, sc.Rule)}
+				entries[obj.Code] = e
+				census.Census = append(census.Census, e)
+			}
+			e.Count++
+			if !inSoup[obj.Code] {
+				inSoup[obj.Code] = true
+				e.Soups++
+			}
+			census.Objects++
+		}
+		if len(r.Codes) > 0 || !r.Stabilized {
+			census.Rare = append(census.Rare, r)
+		}
+	}
+	sort.SliceStable(census.Census, func(i, j int) bool {
+		a, b := census.Census[i], census.Census[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Code < b.Code
+	})
+	return
+}
+
+// Save a rare soup (on its board) as RLE.
+func saveRareSoup(sc *SearchConfig, r *XSoupResult) (err error) {
+	soup, err := ParseSoup(r.Source)
+	if err != nil {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#N soup %d\n#C source %s\n#C margin %d\n", r.Seed, r.Source, sc.Margin)
+	switch {
+	case r.Overflowed:
+		fmt.Fprintf(&sb, "#C reached the board edge after %d generations\n", r.Generations)
+	case !r.Stabilized:
+		fmt.Fprintf(&sb, "#C not stabilized after %d generations\n", r.Generations)
+	}
+	for _, code := range r.Codes {
+		fmt.Fprintf(&sb, "#C object %s\n", code)
+	}
+	sb.WriteString(FormatRLE(soupBoard(soup, sc.Margin), sc.Rule))
+	r.File = filepath.Join(sc.SaveDir, "soup-"+strconv.FormatInt(r.Seed, 10)+".rle")
+	err = ioutil.WriteFile(r.File, []byte(sb.String()), 0644)
+	return
+}
+
+// Output a census as JSON.
+func WriteCensusJSON(out io.Writer, census *XCensus) (err error) {
+	ba, err := json.MarshalIndent(census, "", "  ")
+	if err != nil {
+		return
+	}
+	_, err = out.Write(ba)
+	return
+}
+
+var censusTemplate = template.Must(template.New("census").Funcs(template.FuncMap{
+	"percent": func(n, total int) string {
+		if total == 0 {
+			return "0.00"
+		}
+		return strconv.FormatFloat(100*float64(n)/float64(total), 'f', 2, 64)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Soup census</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 2px 8px; text-align: left; }
+td.n { text-align: right; }
+tr.rare { background: #ffd; }
+code { font-size: small; }
+</style>
+</head>
+<body>
+<h1>Soup census</h1>
+<p>Rule {{.Rule}}; {{.Soups}} soups of {{.Width}}x{{.Height}} at density {{.Density}}
+{{- if .Symmetry}}, symmetry {{.Symmetry}}{{end}}; seeds from {{.FirstSeed}}.
+{{.Stabilized}} stabilized, {{.Unstabilized}} did not ({{.Overflowed}} reached the board edge); {{.Objects}} objects in {{.Duration}}ms.</p>
+<table>
+<tr><th>Code</th><th>Name</th><th>Kind</th><th>Count</th><th>%</th><th>Soups</th><th>First seed</th></tr>
+{{- $total := .Objects}}
+{{- range .Census}}
+<tr{{if .Rare}} class="rare"{{end}}><td><code>{{.Code}}</code></td><td>{{.Name}}</td><td>{{.Kind}}</td>
+<td class="n">{{.Count}}</td><td class="n">{{percent .Count $total}}</td><td class="n">{{.Soups}}</td><td class="n">{{.FirstSeed}}</td></tr>
+{{- end}}
+</table>
+<h2>Rare soups</h2>
+<table>
+<tr><th>Seed</th><th>Source</th><th>Generations</th><th>Objects</th></tr>
+{{- range .Rare}}
+<tr><td class="n">{{.Seed}}</td><td><code>{{.Source}}</code></td>
+<td class="n">{{.Generations}}{{if .Overflowed}} (reached the edge){{else if not .Stabilized}} (not stabilized){{end}}</td>
+<td>{{range .Codes}}<code>{{.}}</code> {{end}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// Output a census as an HTML page.
+func WriteCensusHTML(out io.Writer, census *XCensus) (err error) {
+	return censusTemplate.Execute(out, census)
+}
+
+// Output a census summary as text.
+func PrintCensus(out io.Writer, census *XCensus) {
+	fmt.Fprintf(out, "%d soups (%d stabilized, %d reached the board edge), %d objects in %dms\n",
+		census.Soups, census.Stabilized, census.Overflowed, census.Objects, census.Duration)
+	fmt.Fprintf(out, "%8s  %-16s %s\n", "count", "name", "code")
+	for _, e := range census.Census {
+		fmt.Fprintf(out, "%8d  %-16s %s\n", e.Count, e.Name, e.Code)
+	}
+	for _, r := range census.Rare {
+		note := strings.Join(r.Codes, " ")
+		switch {
+		case r.Overflowed:
+			note = strings.TrimSpace("reached the board edge " + note)
+		case !r.Stabilized:
+			note = strings.TrimSpace("not stabilized " + note)
+		}
+		fmt.Fprintf(out, "rare: %s %s\n", r.Source, note)
+	}
+}
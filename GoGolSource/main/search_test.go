@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestSearchRunMatchesRun(t *testing.T) {
+	for _, rule := range []string{"B3/S23", "B36/S23", "B03/S23"} {
+		r, err := ParseRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		soup := &Soup{Width: 16, Height: 16, Density: 0.5, Seed: 3}
+		g := &Game{Runs: make(map[string]*GameRun), Quiet: true}
+		gr := NewGameRunFromGrid("soup", soup.String(), soupBoard(soup, 20), g)
+		gr.Rule, gr.GoroutineCount = r, 1
+		sr := newSearchRun(g, soupBoard(soup, 20), r)
+		for gen := 1; gen <= 300; gen++ {
+			if err = gr.NextCycle(); err != nil {
+				t.Fatal(err)
+			}
+			stepRun(sr)
+			if !sameGrid(sr.CurrentGrid, gr.CurrentGrid) {
+				t.Fatalf("%s: generation %d differs", rule, gen)
+			}
+			if gen == 100 { // take cells off both, as escapees are
+				removeEscapees(sr.CurrentGrid)
+				removeEscapees(gr.CurrentGrid)
+				sr.tiles = nil
+			}
+		}
+		if len(sr.Cycles) != 0 {
+			t.Errorf("%s: search run kept %d cycles", rule, len(sr.Cycles))
+		}
+	}
+}
+
+func TestSearchCensus(t *testing.T) {
+	sc := &SearchConfig{Soups: 4, Workers: 2, Width: 16, Height: 16, Density: 0.5,
+		FirstSeed: 1, Margin: 96, Generations: 20_000, Rule: ConwayRule, Out: ioutil.Discard}
+	census, err := RunSearch(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if census.Soups != 4 || census.Stabilized+census.Unstabilized != 4 || census.Objects == 0 {
+		t.Errorf("census %+v", census)
+	}
+	counted := 0
+	for _, e := range census.Census {
+		counted += e.Count
+		if e.Code == unknownCode {
+			continue
+		}
+		if name := objectName(e.Code, ConwayRule); e.Name != name {
+			t.Errorf("%s named %q, want %q", e.Code, e.Name, name)
+		}
+	}
+	if counted != census.Objects {
+		t.Errorf("census counts %d objects, want %d", counted, census.Objects)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Seed (initial grid) limits.
+var (
+	MaxSeedBytes     int64 = 4 << 20 // upload or download size
+	MaxSeedDimension       = 4096    // grid width or height
+)
+
+// Seed kinds (besides image kinds like "png").
+const (
+	rleKind       = "rle"
+	plaintextKind = "plaintext"
+	life106Kind   = "life1.06"
+	patternKind   = "pattern"
+	randomKind    = "random"
+)
+
+// Error values.
+var (
+	UnknownSeedError  = errors.New("unknown seed format")
+	SeedTooLargeError = errors.New("seed too large")
+)
+
+// Load a seed grid from a URL (see LoadImage for supported URLs).
+func LoadSeed(url string) (grid *Grid, kind string, err error) {
+	if strings.HasPrefix(url, PatternPrefix) {
+		grid, err = LoadPattern(url)
+		kind = patternKind
+		return
+	}
+	if strings.HasPrefix(url, RandomPrefix) {
+		var soup *Soup
+		if soup, err = ParseSoup(url); err == nil {
+			grid, kind = soup.Grid(), randomKind
+		}
+		return
+	}
+	b, err := loadBytes(url)
+	if err != nil {
+		return
+	}
+	grid, kind, err = DecodeSeed(b)
+	return
+}
+
+// Decode a seed grid from image or pattern data.
+// The format is sniffed from the content; any declared type is ignored.
+func DecodeSeed(b []byte) (grid *Grid, kind string, err error) {
+	if int64(len(b)) > MaxSeedBytes {
+		err = SeedTooLargeError
+		return
+	}
+	ct := http.DetectContentType(b)
+	switch {
+	case strings.HasPrefix(ct, "image/"):
+		var img image.Image
+		img, kind, err = decodeImage(b)
+		if err != nil {
+			return
+		}
+		grid, err = GridFromImage(img)
+	case strings.HasPrefix(ct, "text/plain"):
+		text := string(b)
+		switch {
+		case strings.HasPrefix(text, "#Life 1.06"):
+			kind = life106Kind
+			grid, err = ParseLife106(text)
+		case isRLE(text):
+			kind = rleKind
+			grid, err = ParseRLE(text)
+		default:
+			kind = plaintextKind
+			grid, err = ParsePlaintext(text)
+		}
+	default:
+		err = fmt.Errorf("%w: %s", UnknownSeedError, ct)
+	}
+	return
+}
+
+// Check grid dimensions against the limits.
+func checkSeedSize(w, h int) (err error) {
+	if w < 1 || h < 1 || w > MaxSeedDimension || h > MaxSeedDimension {
+		err = fmt.Errorf("%w: %dx%d, maximum %d", SeedTooLargeError, w, h, MaxSeedDimension)
+	}
+	return
+}
+
+// Decode an image after checking its dimensions (so enormous images are
+// rejected before they are allocated).
+func decodeImage(b []byte) (img image.Image, kind string, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	if err = checkSeedSize(config.Width, config.Height); err != nil {
+		return
+	}
+	img, kind, err = image.Decode(bytes.NewReader(b))
+	return
+}
+
+// Make a grid from an image.
+// Map color images to B&W; dark pixels are alive.
+func GridFromImage(img image.Image) (grid *Grid, err error) {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	if err = checkSeedSize(size.X, size.Y); err != nil {
+		return
+	}
+	grid = NewEmptyGrid(size.X, size.Y)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if int(c.R)+int(c.G)+int(c.B) < midValue*3 {
+				grid.setCell(x-bounds.Min.X, y-bounds.Min.Y, 1)
+			}
+		}
+	}
+	return
+}
+
+// Report if text looks like RLE (has an "x = " header line).
+func isRLE(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		return strings.HasPrefix(strings.ReplaceAll(line, " ", ""), "x=")
+	}
+	return false
+}
+
+// A live cell location.
+type cell struct {
+	x, y int
+}
+
+// Make a grid big enough for the cells.
+func gridFromCells(cells []cell, w, h int) (grid *Grid, err error) {
+	for _, c := range cells {
+		if c.x >= w {
+			w = c.x + 1
+		}
+		if c.y >= h {
+			h = c.y + 1
+		}
+	}
+	if err = checkSeedSize(w, h); err != nil {
+		return
+	}
+	grid = NewEmptyGrid(w, h)
+	for _, c := range cells {
+		grid.setCell(c.x, c.y, 1)
+	}
+	return
+}
+
+// Parse a pattern in run length encoded (RLE) format.
+// See https://conwaylife.com/wiki/Run_Length_Encoded.
+// The header size must include all live cells.
+func ParseRLE(text string) (grid *Grid, err error) {
+	w, h := 0, 0
+	x, y, count := 0, 0, 0
+	header := false
+	scanner := bufio.NewScanner(strings.NewReader(text))
+lines:
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(line) == 0 || line[0] == '#':
+			continue
+		case !header:
+			header = true
+			if !isRLE(line) {
+				err = fmt.Errorf("%w: missing RLE header", UnknownSeedError)
+				return
+			}
+			for _, part := range strings.Split(line, ",") {
+				kv := strings.SplitN(part, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, xerr := strconv.Atoi(strings.TrimSpace(kv[1]))
+				switch strings.TrimSpace(kv[0]) {
+				case "x":
+					w, err = v, xerr
+				case "y":
+					h, err = v, xerr
+				}
+				if err != nil {
+					err = fmt.Errorf("bad RLE header %q: %w", line, err)
+					return
+				}
+			}
+			if err = checkSeedSize(w, h); err != nil {
+				return
+			}
+			grid = NewEmptyGrid(w, h)
+			continue
+		}
+		for _, c := range line {
+			n := count
+			if n == 0 {
+				n = 1
+			}
+			switch {
+			case c >= '0' && c <= '9':
+				count = count*10 + int(c-'0')
+				if count > MaxSeedDimension {
+					err = SeedTooLargeError
+					return
+				}
+				continue
+			case c == 'b' || c == '.':
+				x += n
+			case c == '$':
+				x, y = 0, y+n
+			case c == '!':
+				break lines
+			case c == ' ' || c == '\t':
+				continue
+			case c == 'o' || (c >= 'A' && c <= 'Z'):
+				if x+n > w || y >= h {
+					err = fmt.Errorf("RLE cells outside %dx%d", w, h)
+					return
+				}
+				for i := 0; i < n; i++ {
+					grid.setCell(x+i, y, 1)
+				}
+				x += n
+			default:
+				err = fmt.Errorf("bad RLE character %q", c)
+				return
+			}
+			count = 0
+		}
+	}
+	if err = scanner.Err(); err == nil && grid == nil {
+		err = fmt.Errorf("%w: missing RLE header", UnknownSeedError)
+	}
+	return
+}
+
+// Parse a pattern in plaintext (.cells) format; "O" or "*" is alive.
+func ParsePlaintext(text string) (grid *Grid, err error) {
+	var cells []cell
+	y, w := 0, 1
+	for _, line := range strings.Split(strings.TrimRight(text, "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "!") {
+			continue // comment
+		}
+		if len(line) > w {
+			w = len(line)
+		}
+		for x, c := range line {
+			switch c {
+			case 'O', '*':
+				cells = append(cells, cell{x, y})
+			case '.', ' ':
+			default:
+				err = fmt.Errorf("%w: bad plaintext character %q", UnknownSeedError, c)
+				return
+			}
+		}
+		y++
+	}
+	grid, err = gridFromCells(cells, w, y)
+	return
+}
+
+// Parse a pattern in Life 1.06 format (one "x y" pair per line).
+// Coordinates are shifted to be non-negative.
+func ParseLife106(text string) (grid *Grid, err error) {
+	var cells []cell
+	minX, minY := 0, 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		var c cell
+		_, err = fmt.Sscanf(line, "%d %d", &c.x, &c.y)
+		if err != nil {
+			err = fmt.Errorf("bad Life 1.06 line %q: %w", line, err)
+			return
+		}
+		if len(cells) == 0 || c.x < minX {
+			minX = c.x
+		}
+		if len(cells) == 0 || c.y < minY {
+			minY = c.y
+		}
+		cells = append(cells, c)
+	}
+	for i := range cells {
+		cells[i].x -= minX
+		cells[i].y -= minY
+	}
+	grid, err = gridFromCells(cells, 1, 1)
+	return
+}
+
+// Format a grid in RLE format (lines of at most 70 characters).
+func FormatRLE(grid *Grid, rule *Rule) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "x = %d, y = %d, rule = %s\n", grid.Width, grid.Height, rule)
+	line := 0
+	emit := func(n int, tag byte) {
+		if n == 0 {
+			return
+		}
+		item := string(tag)
+		if n > 1 {
+			item = strconv.Itoa(n) + item
+		}
+		if line+len(item) > 70 {
+			sb.WriteByte('\n')
+			line = 0
+		}
+		sb.WriteString(item)
+		line += len(item)
+	}
+	rowEnds := 0 // owed; blank rows and trailing dead cells are not written
+	for y := 0; y < grid.Height; y++ {
+		lastLive := -1
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				lastLive = x
+			}
+		}
+		if lastLive >= 0 {
+			emit(rowEnds, '$')
+			rowEnds = 0
+			run, runTag := 0, byte('b')
+			for x := 0; x <= lastLive; x++ {
+				tag := byte('b')
+				if grid.getCell(x, y) != 0 {
+					tag = 'o'
+				}
+				if tag != runTag {
+					emit(run, runTag)
+					run, runTag = 0, tag
+				}
+				run++
+			}
+			emit(run, runTag)
+		}
+		rowEnds++
+	}
+	sb.WriteString("!\n")
+	return sb.String()
+}
+
+// Format a grid in plaintext (.cells) format.
+func FormatPlaintext(grid *Grid, name string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "!Name: %s\n", name)
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				sb.WriteByte('O')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Format a grid in Life 1.06 format.
+func FormatLife106(grid *Grid) string {
+	var sb strings.Builder
+	sb.WriteString("#Life 1.06\n")
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.getCell(x, y) != 0 {
+				fmt.Fprintf(&sb, "%d %d\n", x, y)
+			}
+		}
+	}
+	return sb.String()
+}
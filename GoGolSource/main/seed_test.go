@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// Get a grid's live cells as plaintext rows.
+func gridRows(grid *Grid) string {
+	return strings.TrimPrefix(FormatPlaintext(grid, ""), "!Name: \n")
+}
+
+func TestParseRLE(t *testing.T) {
+	for _, tc := range []struct {
+		name, text, want string
+	}{
+		{"glider", "#N Glider\nx = 3, y = 3, rule = B3/S23\nbob$2bo$3o!\n", ".O.\n..O\nOOO\n"},
+		{"counts", "x = 12, y = 3\n12o$\n\n2$!", "OOOOOOOOOOOO\n............\n............\n"},
+		{"blank rows", "x = 2, y = 4\no2$bo!", "O.\n..\n.O\n..\n"},
+		{"wrapped", "x = 4, y = 2\nob\nob$\n4o!", "O.O.\nOOOO\n"},
+		{"other states", "x = 3, y = 1\nAbB!", "O.O\n"},
+	} {
+		grid, err := ParseRLE(tc.text)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := gridRows(grid); got != tc.want {
+			t.Errorf("%s: got\n%swant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseRLEErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, text string
+		is         error
+	}{
+		{"no header", "bo$2bo$3o!", UnknownSeedError},
+		{"outside header", "x = 2, y = 2\n3o!", nil},
+		{"below header", "x = 2, y = 1\no$o!", nil},
+		{"bad header", "x = two, y = 2\no!", nil},
+		{"bad character", "x = 2, y = 2\nozo!", nil},
+		{"too large", "x = 5000, y = 2\no!", SeedTooLargeError},
+		{"huge count", "x = 2, y = 2\n99999999o!", SeedTooLargeError},
+	} {
+		_, err := ParseRLE(tc.text)
+		switch {
+		case err == nil:
+			t.Errorf("%s: no error", tc.name)
+		case tc.is != nil && !errors.Is(err, tc.is):
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.is)
+		}
+	}
+}
+
+func TestFormatRLERoundTrip(t *testing.T) {
+	soup, err := ParseSoup("random:?w=150&h=40&density=0.5&seed=11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid := soup.Grid()
+	text := FormatRLE(grid, ConwayRule)
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) > 70 {
+			t.Fatalf("RLE line longer than 70: %q", line)
+		}
+	}
+	parsed, err := ParseRLE(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Width != grid.Width || parsed.Height != grid.Height ||
+		parsed.Checksum() != grid.Checksum() {
+		t.Errorf("round trip changed the grid")
+	}
+}
+
+func TestParseLife106(t *testing.T) {
+	grid, err := ParseLife106("#Life 1.06\n#comment\n0 -1\n1 0\n-1 1\n0 1\n1 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gridRows(grid), ".O.\n..O\nOOO\n"; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if _, err = ParseLife106("#Life 1.06\n1 x\n"); err == nil {
+		t.Errorf("no error for a bad line")
+	}
+	round, err := ParseLife106(FormatLife106(grid))
+	if err != nil || round.Checksum() != grid.Checksum() {
+		t.Errorf("round trip changed the grid: %v", err)
+	}
+}
+
+func TestParsePlaintext(t *testing.T) {
+	grid, err := ParsePlaintext("!Name: Glider\n.O\n..O\nOOO\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gridRows(grid), ".O.\n..O\nOOO\n"; got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+	if _, err = ParsePlaintext(".O.\n.X.\n"); !errors.Is(err, UnknownSeedError) {
+		t.Errorf("got %v for a bad character, want %v", err, UnknownSeedError)
+	}
+}
+
+func TestDecodeSeed(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(2, 1, color.Black)
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		data       string
+		kind, want string
+	}{
+		{b.String(), "png", "...\n..O\n"},
+		{"x = 2, y = 1\nbo!", rleKind, ".O\n"},
+		{"#Life 1.06\n0 0\n1 1\n", life106Kind, "O.\n.O\n"},
+		{".O\nO.\n", plaintextKind, ".O\nO.\n"},
+	} {
+		grid, kind, err := DecodeSeed([]byte(tc.data))
+		if err != nil {
+			t.Errorf("%s: %v", tc.kind, err)
+			continue
+		}
+		if got := gridRows(grid); kind != tc.kind || got != tc.want {
+			t.Errorf("got %s\n%swant %s\n%s", kind, got, tc.kind, tc.want)
+		}
+	}
+	if _, _, err := DecodeSeed([]byte{0, 1, 2, 3}); !errors.Is(err, UnknownSeedError) {
+		t.Errorf("got %v for binary data, want %v", err, UnknownSeedError)
+	}
+}
@@ -2,28 +2,307 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"image/gif"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var spec = ":8080" // means localhost:8080
 
+// Server timeouts; writes allow for long runs.
+var (
+	readTimeout     = 30 * time.Second
+	writeTimeout    = 5 * time.Minute
+	idleTimeout     = 2 * time.Minute
+	shutdownTimeout = time.Minute
+)
+
+// TLS certificate and key files; TLS is used if both are set.
+var certFile, keyFile string
+
 // launch HTTP server for th GoL.
+// Runs until interrupted (SIGINT or SIGTERM) and then drains in-flight runs.
+// SIGHUP reloads the configuration.
 func startServer() (err error) {
-	http.HandleFunc("/play", playHandler)
-	http.HandleFunc("/show", showHandler)
-	http.HandleFunc("/history", historyHandler)
-	fmt.Printf("Starting Server %v...\n", spec)
-	err = http.ListenAndServe(spec, nil)
+	server := NewServer(spec)
+	server.ReadTimeout, server.WriteTimeout = readTimeout, writeTimeout
+	server.IdleTimeout, server.ShutdownTimeout = idleTimeout, shutdownTimeout
+	server.CertFile, server.KeyFile = certFile, keyFile
+	err = server.RegisterDefaultContexts()
+	if err != nil {
+		return
+	}
+	RunScheduler = NewScheduler(workerLimitFlag, queueLimitFlag) // before any request
+	err = server.Open()
+	if err != nil {
+		return
+	}
+	fmt.Printf("Started Server %v...\n", server)
+	stopSweep := make(chan struct{})
+	defer close(stopSweep)
+	go sweepRuns(stopSweep)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if xerr := ReloadConfig(); xerr != nil {
+					fmt.Printf("Config reload failed; configuration unchanged: %v\n", xerr)
+				} else {
+					fmt.Printf("Config reloaded\n")
+				}
+				continue
+			}
+			fmt.Printf("Received %v; stopping Server...\n", sig)
+			err = server.Close()
+		case err = <-server.done:
+		}
+		return
+	}
+}
+
+// Provides a HTTP server for the GoL.
+// Owns its own request multiplexer and HTTP server.
+// Can be opened only one time.
+type Server struct {
+	Address         string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	CertFile        string
+	KeyFile         string
+	Game            *Game // runs drained on close
+
+	lock     sync.Mutex
+	handlers map[string]http.HandlerFunc
+	paths    []string // in registration order
+	mux      *http.ServeMux
+	muxed    map[string]bool // paths added to mux
+	server   *http.Server
+	listener net.Listener
+	done     chan error
+	closed   bool
+}
+
+// Error values.
+var (
+	ServerOpenError   = errors.New("server already opened")
+	ServerClosedError = errors.New("server not open")
+)
+
+func NewServer(address string) (s *Server) {
+	s = &Server{}
+	s.Address = address
+	s.ShutdownTimeout = time.Minute
+	s.Game = CoreGame
+	s.handlers = make(map[string]http.HandlerFunc)
+	s.mux = http.NewServeMux()
+	s.muxed = make(map[string]bool)
+	return
+}
+
+func (s *Server) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	address := s.Address
+	if s.listener != nil {
+		address = s.listener.Addr().String()
+	}
+	return fmt.Sprintf("Server[address=%s, tls=%v, open=%v, handlers=%v]",
+		address, s.useTLS(), s.server != nil && !s.closed, s.paths)
+}
+
+// Register the GoL request handlers.
+func (s *Server) RegisterDefaultContexts() (err error) {
+	var paths []string
+	for _, c := range []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/play", playHandler},
+		{"/show", showHandler},
+		{"/history", historyHandler},
+		{"/runs", runsHandler},
+		{"/runs/", runHandler},
+		{"/metrics", metricsHandler},
+		{"/patterns", patternsHandler},
+		{"/patterns/", patternsHandler},
+		{"/diff", diffHandler},
+		{"/", uiHandler},
+		{"/ui/", uiHandler},
+		{"/openapi.json", openAPIHandler},
+		{"/account", accountHandler},
+	} {
+		if err = s.RegisterContext(c.path, c.handler); err != nil {
+			return
+		}
+		paths = append(paths, c.path)
+	}
+	err = checkOpenAPI(paths)
+	return
+}
+
+// Register a handler for a path (as in http.ServeMux).
+// Allowed before or after the server is opened.
+func (s *Server) RegisterContext(path string, handler http.HandlerFunc) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.handlers[path]; ok {
+		return fmt.Errorf("path already exists: %s", path)
+	}
+	s.handlers[path] = handler
+	s.paths = append(s.paths, path)
+	if !s.muxed[path] {
+		s.muxed[path] = true
+		s.mux.HandleFunc(path, func(writer http.ResponseWriter, request *http.Request) {
+			s.dispatch(path, writer, request)
+		})
+	}
+	return
+}
+
+// Remove the handler for a path; later requests to it get 404.
+func (s *Server) RemoveContext(path string) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.handlers[path]; !ok {
+		return fmt.Errorf("unknown path: %s", path)
+	}
+	delete(s.handlers, path)
+	for i, p := range s.paths {
+		if p == path {
+			s.paths = append(s.paths[:i], s.paths[i+1:]...)
+			break
+		}
+	}
+	return
+}
+
+// Get the registered paths in registration order.
+func (s *Server) ContextPaths() (paths []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	paths = append(paths, s.paths...)
+	return
+}
+
+// Send a request to the currently registered handler for a path.
+func (s *Server) dispatch(path string, writer http.ResponseWriter, request *http.Request) {
+	s.lock.Lock()
+	handler, ok := s.handlers[path]
+	s.lock.Unlock()
+	if !ok {
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
+		return
+	}
+	MetricsWrapper(path, authWrapper(path, handler))(writer, request)
+}
+
+// Get the request handler (ex. for use with httptest).
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Get the listening address (useful when opened on port 0).
+func (s *Server) Addr() (addr net.Addr) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener != nil {
+		addr = s.listener.Addr()
+	}
+	return
+}
+
+func (s *Server) useTLS() bool {
+	return len(s.CertFile) > 0 && len(s.KeyFile) > 0
+}
+
+// Start listening and serving requests in the background.
+func (s *Server) Open() (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.server != nil {
+		return ServerOpenError
+	}
+	if s.useTLS() {
+		// fail now, not on first request, if the files are bad
+		if _, err = tls.LoadX509KeyPair(s.CertFile, s.KeyFile); err != nil {
+			return
+		}
+	}
+	s.listener, err = net.Listen("tcp", s.Address)
+	if err != nil {
+		return
+	}
+	s.server = &http.Server{
+		Handler:      s.mux,
+		ReadTimeout:  s.ReadTimeout,
+		WriteTimeout: s.WriteTimeout,
+		IdleTimeout:  s.IdleTimeout,
+	}
+	s.done = make(chan error, 1)
+	go func(server *http.Server, listener net.Listener, tls bool) {
+		var err error
+		if tls {
+			err = server.ServeTLS(listener, s.CertFile, s.KeyFile)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+		s.done <- err
+	}(s.server, s.listener, s.useTLS())
+	return
+}
+
+// Stop accepting requests, wait (up to ShutdownTimeout) for in-flight
+// requests and runs to finish and then close.
+func (s *Server) Close() (err error) {
+	s.lock.Lock()
+	if s.server == nil || s.closed {
+		s.lock.Unlock()
+		return ServerClosedError
+	}
+	s.closed = true
+	server := s.server
+	s.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		server.Close() // force; error ignored
+		return
+	}
+	if s.Game != nil {
+		err = s.Game.WaitRuns(ctx)
+	}
+	for _, g := range allGames() {
+		if err == nil && g != s.Game {
+			err = g.WaitRuns(ctx)
+		}
+	}
 	return
 }
 
@@ -35,16 +314,34 @@ func startServer() (err error) {
 
 // Represents a game.
 type XGame struct {
-	Runs map[string]*XGameRun
+	Runs      map[string]*XGameRun
+	Evictions []*XEviction `json:",omitempty"` // recent, most recent first
+}
+
+// Marshal the runs (by name) as XML, which cannot represent maps.
+func (xg XGame) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	list := struct {
+		Runs      []*XGameRun  `xml:"Runs>GameRun"`
+		Evictions []*XEviction `xml:"Evictions>Eviction,omitempty"`
+	}{Evictions: xg.Evictions}
+	for _, r := range records(&xg) {
+		list.Runs = append(list.Runs, r.(*XGameRun))
+	}
+	return e.EncodeElement(list, start)
 }
 
 type XGameCycle struct {
-	Cycle           int   `json:"cycle" xml:"Cycle"`
-	StartedAt       int64 `json:"startedAtNS" xml:"StartedAtEpochNS"`
-	EndedAt         int64 `json:"endedAtNS" xml:"EndedAtEpochNS"`
-	Duration        int64 `json:"durationMS" xml:"DurationMS"`
-	GorountineCount int   `json:"goroutineCount" xml:"GorountineCount"`
-	MaxCycles       int   `json:"maximumCycles" xml:"MaximumCycles"`
+	Cycle           int    `json:"cycle" xml:"Cycle"`
+	StartedAt       int64  `json:"startedAtNS" xml:"StartedAtEpochNS"`
+	EndedAt         int64  `json:"endedAtNS" xml:"EndedAtEpochNS"`
+	Duration        int64  `json:"durationMS" xml:"DurationMS"`
+	GorountineCount int    `json:"goroutineCount" xml:"GorountineCount"`
+	MaxCycles       int    `json:"maximumCycles" xml:"MaximumCycles"`
+	Checksum        string `json:"checksum,omitempty" xml:"Checksum,omitempty"` // CRC-64 of the grid after
+	Population      int    `json:"population" xml:"Population"`                 // live cells after
+	TileSize        int    `json:"tileSize" xml:"TileSize"`                     // cells across a tile
+	Tiles           int    `json:"tiles" xml:"Tiles"`                           // of the grid
+	ActiveTiles     int    `json:"activeTiles" xml:"ActiveTiles"`               // recomputed
 }
 
 type XGameRun struct {
@@ -55,155 +352,238 @@ type XGameRun struct {
 	Duration    int64         `json:"durationMS" xml:"DurationMS"`
 	Width       int           `json:"width" xml:"Width"`
 	Height      int           `json:"height" xml:"Height"`
+	OriginX     int           `json:"originX,omitempty" xml:"OriginX,omitempty"` // world coordinates of the top left
+	OriginY     int           `json:"originY,omitempty" xml:"OriginY,omitempty"` // cell (if unbounded)
+	Rule        string        `json:"rule" xml:"Rule"`
+	Kernel      string        `json:"kernel" xml:"Kernel"`
+	Topology    string        `json:"topology" xml:"Topology"`
+	MaxCycles   int           `json:"maximumCycles" xml:"MaximumCycles"`
+	Goroutines  int           `json:"goroutineCount" xml:"GoroutineCount"`
+	Soup        *Soup         `json:"soup,omitempty" xml:"Soup,omitempty"`
+	SeedSum     string        `json:"seedChecksum,omitempty" xml:"SeedChecksum,omitempty"` // CRC-64 of the initial grid
 	Cycles      []*XGameCycle `json:"gameCycles" xml:"GameCycles>GameCycle,omitempty"`
+	Events      []*XRunEvent  `json:"events,omitempty" xml:"Events>Event,omitempty"`
+	Lineage     *XLineage     `json:"lineage,omitempty" xml:"Lineage,omitempty"`
+	Pinned      bool          `json:"pinned,omitempty" xml:"Pinned,omitempty"`
+	Priority    string        `json:"priority" xml:"Priority"`
+	State       string        `json:"state,omitempty" xml:"State,omitempty"`                 // queued, running or done
+	QueuePos    int           `json:"queuePosition,omitempty" xml:"QueuePosition,omitempty"` // 1 is next
+	WaitMS      int64         `json:"waitMS" xml:"WaitMS"`                                   // in the run queue
+	Tuning      *XTuning      `json:"tuning,omitempty" xml:"Tuning,omitempty"`               // if auto-tuned
+	ViewedAt    int64         `json:"viewedAtNS" xml:"ViewedAtEpochNS"`
 	DelayIn10ms int           `json:"delay10MS" xml:"Delay10MS"`
 	PlayIndex   int           `json:"playIndex" xml:"PlayIndex"`
 }
 
-func getLead(s string) (res string) {
-	res = s
-	posn := strings.Index(s, "?")
-	if posn >= 0 {
-		res = s[0:posn]
-	}
-	return
-}
-
-// History request handler
+// History request handler.
+// Adapter over the runs API.
 func historyHandler(writer http.ResponseWriter, request *http.Request) {
 	switch request.Method {
 	case "GET":
-		if getLead(request.RequestURI) != "/history" {
-			writer.WriteHeader(405)
+		if request.URL.Path != "/history" {
+			sendError(writer, 404, "unknown resource %s", request.URL.Path)
+			return
+		}
+		ct, ok := negotiate(request, runTypes...)
+		if !ok {
+			sendError(writer, 406, "supported types: %s", strings.Join(runTypes, ", "))
 			return
 		}
 		game := &XGame{}
 		game.Runs = make(map[string]*XGameRun)
-		for k, g := range CoreGame.Runs {
-			game.Runs[k] = makeReturnedRun(k, g.ImageURL)
+		runs := requestGame(request)
+		for _, xr := range listRuns(runs, 0, len(runs.RunNames()), "", "", "").Runs {
+			game.Runs[xr.Name] = xr
 		}
-		ba, err := json.MarshalIndent(game, "", "  ")
-		if err != nil {
-			writer.WriteHeader(500)
+		game.Evictions = runs.Evictions()
+		sendValue(writer, 200, ct, game)
+	case "DELETE":
+		if request.URL.Path != "/history" {
+			sendError(writer, 404, "unknown resource %s", request.URL.Path)
 			return
 		}
-		writer.Header().Add("Content-Type", "text/json")
-		writer.WriteHeader(200)
-		writer.Write(ba) // send response; error ignored
-	case "DELETE":
-		if request.RequestURI != "/history" {
-			writer.WriteHeader(405)
+		query := request.URL.Query()
+		all, user := query.Get("all") == "true", query.Get("user")
+		if (all || len(user) > 0) && !requestIsAdmin(request) {
+			sendError(writer, 403, "only admins can clear other users' runs")
 			return
 		}
-		for k, _ := range CoreGame.Runs {
-			delete(CoreGame.Runs, k)
+		switch {
+		case all:
+			for _, g := range allGames() {
+				g.Clear()
+			}
+		case len(user) > 0:
+			authLock.Lock()
+			u, ok := users[user]
+			authLock.Unlock()
+			if !ok {
+				sendError(writer, 404, "user %q not found", user)
+				return
+			}
+			u.Game.Clear()
+		default:
+			requestGame(request).Clear()
 		}
 		writer.WriteHeader(204)
 	default:
-		writer.WriteHeader(405)
+		sendError(writer, 405, "method %s not allowed", request.Method)
 	}
 }
 
 // Play request handler.
+// Adapter over the runs API; replaces any run with the same name.
+// GET loads the seed from the url parameter; POST supplies the seed as
+// a form upload or as the raw request body. Run settings (cycles,
+// goroutines, rule, kernel, topology, delay) come from parameters, form
+// fields or a JSON body.
 func playHandler(writer http.ResponseWriter, request *http.Request) {
-	if request.Method != "GET" || getLead(request.RequestURI) != "/play" {
-		writer.WriteHeader(405)
-		return
-	}
-	err := request.ParseForm() // get query parameters
-	if err != nil {
-		writer.WriteHeader(400)
+	if request.URL.Path != "/play" {
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
 		return
 	}
-	name := request.Form.Get("name")
-	url := request.Form.Get("url")
-	if len(url) == 0 || len(name) == 0 {
-		writer.WriteHeader(400)
+	rr := &XRunRequest{}
+	var err error
+	switch request.Method {
+	case "GET":
+		err = request.ParseForm() // get query parameters
+		if err != nil {
+			sendError(writer, 400, "bad parameters: %v", err)
+			return
+		}
+		if err = readRunForm(request.Form, rr); err != nil {
+			sendError(writer, 400, "bad parameters: %v", err)
+			return
+		}
+		if len(rr.Source) == 0 || len(rr.Name) == 0 {
+			sendError(writer, 400, "name and url are required")
+			return
+		}
+	case "POST":
+		rr, err = readRunRequest(writer, request)
+		if err != nil {
+			sendError(writer, bodyErrorStatus(err), "bad request body: %v", err)
+			return
+		}
+		if len(rr.Name) == 0 || len(rr.Seed) == 0 && len(rr.Source) == 0 {
+			sendError(writer, 400, "name and a seed (or url) are required")
+			return
+		}
+	default:
+		writer.Header().Set("Allow", "GET, POST")
+		sendError(writer, 405, "method %s not allowed", request.Method)
 		return
 	}
+	// the ct parameter (or, for GET, Content-Type) overrides Accept
 	ct := request.Form.Get("ct")
-	if len(ct) == 0 {
+	if len(ct) == 0 && request.Method == "GET" {
 		ct = request.Header.Get("content-type")
 	}
-	ct = strings.ToLower(ct)
-	switch ct {
-	case "":
-		ct = "application/json"
-	case "application/json", "text/json":
-	case "application/xml", "text/xml":
-	default:
-		writer.WriteHeader(400)
-		return
-	}
-
-	err = CoreGame.Run(name, url)
-	if err != nil {
-		writer.WriteHeader(500)
-		return
-	}
-	run := makeReturnedRun(name, url)
-
-	var ba []byte
-	switch ct {
-	case "application/json", "text/json":
-		ba, err = json.MarshalIndent(run, "", "  ")
-		if err != nil {
-			writer.WriteHeader(500)
+	if len(ct) > 0 {
+		ct = canonicalType(strings.Split(ct, ";")[0])
+		if _, ok := Formatters[ct]; !ok {
+			sendError(writer, 400, "unsupported content type %q", ct)
 			return
 		}
-		writer.Header().Add("Content-Type", "text/json")
-	case "application/xml", "text/xml":
-		ba, err = xml.MarshalIndent(run, "", "  ")
-		if err != nil {
-			writer.WriteHeader(500)
+	} else {
+		var ok bool
+		ct, ok = negotiate(request, runTypes...)
+		if !ok {
+			sendError(writer, 406, "supported types: %s", strings.Join(runTypes, ", "))
 			return
 		}
-		writer.Header().Add("Content-Type", "text/xml")
 	}
 
-	writer.WriteHeader(200)
-	writer.Write(ba) // send response; error ignored
+	gr, status, err := createRun(request, "play", rr, true)
+	if err != nil {
+		if status == 422 {
+			status = 500
+		}
+		sendError(writer, status, "%v", err)
+		return
+	}
+	sendValue(writer, 200, ct, makeReturnedRun(gr))
 }
 
 // Build data for returned run.
-func makeReturnedRun(name, url string) *XGameRun {
-	run := CoreGame.Runs[name]
+func makeReturnedRun(run *GameRun) *XGameRun {
+	pinned, viewedAt := run.retention() // before the run lock
+	state, wait := run.status()
+	run.lock.Lock()
+	defer run.lock.Unlock()
 	xrun := &XGameRun{}
 	xrun.Name = run.Name
-	xrun.ImageURL = url
+	xrun.ImageURL = run.ImageURL
 	xrun.PlayIndex = run.PlayIndex
 	xrun.DelayIn10ms = run.DelayIn10ms
 	xrun.Height = run.Height
 	xrun.Width = run.Width
+	if grid := run.CurrentGrid; grid != nil {
+		xrun.OriginX, xrun.OriginY = grid.X, grid.Y
+	}
+	xrun.Rule = run.Rule.String()
+	xrun.Kernel = run.Kernel
+	xrun.Topology = run.Topology
+	xrun.MaxCycles = run.MaxCycles
+	xrun.Goroutines = run.GoroutineCount
+	xrun.Soup = run.Soup
+	xrun.Lineage = run.Lineage
+	xrun.Pinned = pinned
+	xrun.Priority = run.Priority
+	xrun.Tuning = run.Tuning
+	xrun.State, xrun.WaitMS = state, int64((wait+NanosPerMs/2)/NanosPerMs)
+	if s := RunScheduler; s != nil && state == queuedState {
+		xrun.QueuePos = s.Position(run)
+	}
+	if !viewedAt.IsZero() {
+		xrun.ViewedAt = viewedAt.UnixNano()
+	}
+	xrun.SeedSum = formatChecksum(run.InitialGrid.Checksum())
 	xrun.StartedAt = run.StartedAt.UnixNano()
 	xrun.EndedAt = run.EndedAt.UnixNano()
 	xrun.Duration = (xrun.EndedAt - xrun.StartedAt + NanosPerMs/2) / NanosPerMs
 	xrun.Cycles = make([]*XGameCycle, 0, 100)
 
 	for _, r := range run.Cycles {
-		xc := &XGameCycle{}
-		xc.StartedAt = r.StartedAt.UnixNano()
-		xc.EndedAt = r.EndedAt.UnixNano()
-		xc.Duration = (xc.EndedAt - xc.StartedAt + NanosPerMs/2) / NanosPerMs
-		xc.Cycle = r.Cycle
-		xc.GorountineCount = CoreGame.GoroutineCount
-		xc.MaxCycles = CoreGame.MaxCycles
-		xrun.Cycles = append(xrun.Cycles, xc)
+		xrun.Cycles = append(xrun.Cycles, makeReturnedCycle(r))
+	}
+	if len(run.Events) > 0 {
+		xrun.Events = makeReturnedEvents(run)
 	}
 	return xrun
 }
 
+// Make the client form of a cycle.
+func makeReturnedCycle(r *GameCycle) (xc *XGameCycle) {
+	xc = &XGameCycle{}
+	xc.StartedAt = r.StartedAt.UnixNano()
+	xc.EndedAt = r.EndedAt.UnixNano()
+	xc.Duration = (xc.EndedAt - xc.StartedAt + NanosPerMs/2) / NanosPerMs
+	xc.Cycle = r.Cycle
+	xc.GorountineCount = r.Goroutines
+	xc.MaxCycles = r.MaxCycles
+	xc.Checksum = formatChecksum(r.Checksum)
+	xc.Population = r.Population
+	xc.TileSize, xc.Tiles, xc.ActiveTiles = r.TileSize, r.Tiles, r.ActiveTiles
+	return
+}
+
 var re = regexp.MustCompile(`^(\d+)x(\d+)$`)
 
 // Show request handler.
 func showHandler(writer http.ResponseWriter, request *http.Request) {
-	if request.Method != "GET" || getLead(request.RequestURI) != "/show" {
-		writer.WriteHeader(405)
+	if request.URL.Path != "/show" {
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
+		return
+	}
+	if request.Method != "GET" {
+		writer.Header().Set("Allow", "GET")
+		sendError(writer, 405, "method %s not allowed", request.Method)
 		return
 	}
 	err := request.ParseForm() // get query parameters
 	if err != nil {
-		writer.WriteHeader(400)
+		sendError(writer, 400, "bad parameters: %v", err)
 		return
 	}
 	name := request.Form.Get("name")
@@ -220,18 +600,23 @@ func showHandler(writer http.ResponseWriter, request *http.Request) {
 	}
 	maxCount, err := strconv.Atoi(xmaxCount)
 	if err != nil || maxCount < 1 || maxCount > 100 {
-		writer.WriteHeader(400)
+		sendError(writer, 400, "maxCount must be 1 to 100")
 		return
 	}
 	xmag := request.Form.Get("mag")
 	if len(xmag) > 0 {
 		mag, err := strconv.Atoi(xmag)
 		if err != nil || mag < 1 || mag > 20 {
-			writer.WriteHeader(400)
+			sendError(writer, 400, "mag must be 1 to 20")
 			return
 		}
 		magFactorFlag = mag
 	}
+	view, err := readViewport(request.Form)
+	if err != nil {
+		sendError(writer, 400, "%v", err)
+		return
+	}
 
 	index := 0
 	// verify parameters based on type
@@ -244,46 +629,46 @@ func showHandler(writer http.ResponseWriter, request *http.Request) {
 		}
 		index, err = strconv.Atoi(xindex)
 		if err != nil {
-			writer.WriteHeader(400)
+			sendError(writer, 400, "bad index %q", xindex)
 			return
 		}
 		xgrid := request.Form.Get("grid")
 		if len(xgrid) > 0 {
 			parts := re.FindStringSubmatch(xgrid)
 			if len(parts) != 2 {
-				writer.WriteHeader(400)
+				sendError(writer, 400, "bad grid %q", xgrid)
 				return
 			}
 			gridFlag = fmt.Sprintf("%sx%s", parts[0], parts[1])
 		}
 	default:
-		writer.WriteHeader(400)
+		sendError(writer, 400, "form must be gif or png")
 		return
 	}
 
-	gr, ok := CoreGame.Runs[name]
-	if ! ok {
-		writer.WriteHeader(404)
+	gr, ok := requestGame(request).ViewRun(name)
+	if !ok {
+		sendError(writer, 404, "run %q not found", name)
 		return
 	}
 	// return requested image type
 	switch form {
 	case "gif", "GIF":
-		gifs, err := gr.MakeGIFs(maxCount)
+		gifs, err := gr.MakeGIFsView(maxCount, view)
 		if err != nil {
-			writer.WriteHeader(500)
+			sendError(writer, 500, "cannot make images: %v", err)
 			return
 		}
 		var buf bytes.Buffer
 		err = gif.EncodeAll(&buf, gifs)
 		if err != nil {
-			writer.WriteHeader(500)
+			sendError(writer, 500, "cannot encode GIF: %v", err)
 			return
 		}
 		count, err := writer.Write(buf.Bytes()) // send response
 		log.Printf("Returned GIF, size=%d\n", count)
 		if saveImageFlag {
-			saveFile := fmt.Sprintf("/temp/Image_%s.gif", name)
+			saveFile := filepath.Join(saveDirFlag, fmt.Sprintf("Image_%s.gif", name))
 			xerr := ioutil.WriteFile(saveFile, buf.Bytes(), os.ModePerm)
 			fmt.Printf("Save %s: %v\n", saveFile, xerr)
 		}
@@ -291,22 +676,22 @@ func showHandler(writer http.ResponseWriter, request *http.Request) {
 		if gridFlag == "1x1" {
 			if index <= maxCount {
 				var buf bytes.Buffer
-				err = gr.MakePNG(&buf, index)
+				err = gr.MakePNGView(&buf, index, view)
 				if err != nil {
 					code := 500
 					if err == BadIndexError {
 						code = 400
 					}
-					writer.WriteHeader(code)
+					sendError(writer, code, "cannot make image: %v", err)
 					return
 				}
 				writer.Write(buf.Bytes()) // send response; error ignored
 			} else {
-				writer.WriteHeader(400)
+				sendError(writer, 400, "index must be at most maxCount (%d)", maxCount)
 			}
 		} else {
 			// currently not implemented
-			writer.WriteHeader(400)
+			sendError(writer, 400, "only grid=1x1 is supported")
 		}
 	}
 }
\ No newline at end of file
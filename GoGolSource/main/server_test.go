@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShowErrorsAreJSON(t *testing.T) {
+	for _, tc := range []struct {
+		method, target string
+		status         int
+	}{
+		{"POST", "/show", 405},
+		{"GET", "/show/x", 404},
+		{"GET", "/show?maxCount=0", 400},
+		{"GET", "/show?mag=99", 400},
+		{"GET", "/show?x=a", 400},
+		{"GET", "/show?form=bmp", 400},
+		{"GET", "/show?form=png&index=a", 400},
+		{"GET", "/show?name=no-such-run", 404},
+	} {
+		recorder := httptest.NewRecorder()
+		showHandler(recorder, httptest.NewRequest(tc.method, tc.target, nil))
+		var xe XError
+		if err := json.Unmarshal(recorder.Body.Bytes(), &xe); err != nil {
+			t.Errorf("%s %s: body is not an error: %v", tc.method, tc.target, err)
+			continue
+		}
+		if recorder.Code != tc.status || xe.Status != tc.status || len(xe.Message) == 0 {
+			t.Errorf("%s %s: got %d %+v, want %d", tc.method, tc.target, recorder.Code, xe, tc.status)
+		}
+	}
+}
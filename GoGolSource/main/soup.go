@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Random soups.
+// A soup is a random board reproducible from its parameters alone, given
+// as a "random:" URL, ex. "random:?w=64&h=64&density=0.4&seed=7&symmetry=C4".
+// Defaults are a 64x64 board, density 0.5, no symmetry and a seed from the
+// clock (recorded so the run can be repeated).
+
+const RandomPrefix = "random:" // random soup (vs. file or network)
+
+// Soup symmetries.
+const (
+	NoSymmetry = ""
+	C2Symmetry = "C2" // 180 degree rotation
+	C4Symmetry = "C4" // 90 degree rotation; square boards only
+	D8Symmetry = "D8" // rotations and reflections; square boards only
+)
+
+// Soup parameters.
+type Soup struct {
+	Width    int     `json:"width" xml:"Width"`
+	Height   int     `json:"height" xml:"Height"`
+	Density  float64 `json:"density" xml:"Density"`
+	Seed     int64   `json:"seed" xml:"Seed"`
+	Symmetry string  `json:"symmetry,omitempty" xml:"Symmetry,omitempty"`
+}
+
+// Parse a "random:" URL.
+func ParseSoup(url string) (s *Soup, err error) {
+	query := strings.TrimPrefix(strings.TrimPrefix(url, RandomPrefix), "?")
+	values, err := neturl.ParseQuery(query)
+	if err != nil {
+		return
+	}
+	s = &Soup{Width: 64, Height: 64, Density: 0.5, Seed: time.Now().UnixNano()}
+	for k, vs := range values {
+		v := vs[0]
+		switch k {
+		case "w":
+			s.Width, err = strconv.Atoi(v)
+		case "h":
+			s.Height, err = strconv.Atoi(v)
+		case "density":
+			s.Density, err = strconv.ParseFloat(v, 64)
+			if err == nil && (s.Density < 0 || s.Density > 1) {
+				err = fmt.Errorf("must be 0 to 1")
+			}
+		case "seed":
+			s.Seed, err = strconv.ParseInt(v, 10, 64)
+		case "symmetry":
+			s.Symmetry = strings.ToUpper(v)
+			switch s.Symmetry {
+			case NoSymmetry, C2Symmetry, C4Symmetry, D8Symmetry:
+			default:
+				err = fmt.Errorf("want C2, C4 or D8")
+			}
+		default:
+			return nil, fmt.Errorf("unknown random parameter %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad random parameter %s=%q: %v", k, v, err)
+		}
+	}
+	if err = checkSeedSize(s.Width, s.Height); err != nil {
+		return nil, err
+	}
+	if (s.Symmetry == C4Symmetry || s.Symmetry == D8Symmetry) && s.Width != s.Height {
+		return nil, fmt.Errorf("symmetry %s needs a square board, not %dx%d",
+			s.Symmetry, s.Width, s.Height)
+	}
+	return
+}
+
+// Get the URL that reproduces the soup.
+func (s *Soup) String() string {
+	url := fmt.Sprintf("%s?w=%d&h=%d&density=%s&seed=%d", RandomPrefix, s.Width, s.Height,
+		strconv.FormatFloat(s.Density, 'g', -1, 64), s.Seed)
+	if len(s.Symmetry) > 0 {
+		url += "&symmetry=" + s.Symmetry
+	}
+	return url
+}
+
+// Make the soup's grid.
+// Cells are chosen in row order; each choice is copied to the cell's images
+// under the symmetry, so the same parameters always make the same grid.
+func (s *Soup) Grid() (grid *Grid) {
+	grid = NewEmptyGrid(s.Width, s.Height)
+	done := make([]bool, s.Width*s.Height)
+	r := rand.New(rand.NewSource(s.Seed))
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			if done[y*s.Width+x] {
+				continue
+			}
+			v := byte(0)
+			if r.Float64() < s.Density {
+				v = 1
+			}
+			for _, p := range s.images(x, y) {
+				grid.setCell(p.x, p.y, v)
+				done[p.y*s.Width+p.x] = true
+			}
+		}
+	}
+	return
+}
+
+// Get the cells a cell maps to under the symmetry (including itself).
+func (s *Soup) images(x, y int) (cells []cell) {
+	mx, my := s.Width-1-x, s.Height-1-y
+	cells = []cell{{x, y}}
+	switch s.Symmetry {
+	case C2Symmetry:
+		cells = append(cells, cell{mx, my})
+	case C4Symmetry:
+		cells = append(cells, cell{my, x}, cell{mx, my}, cell{y, mx})
+	case D8Symmetry:
+		cells = append(cells, cell{my, x}, cell{mx, my}, cell{y, mx},
+			cell{mx, y}, cell{x, my}, cell{y, x}, cell{my, mx})
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestSoupReproducible(t *testing.T) {
+	url := "random:?w=40&h=30&density=0.35&seed=7"
+	a, err := ParseSoup(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseSoup(a.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != *b {
+		t.Errorf("String() does not reproduce the soup: %v, %v", a, b)
+	}
+	if a.Grid().Checksum() != b.Grid().Checksum() {
+		t.Errorf("same parameters made different grids")
+	}
+	c, _ := ParseSoup("random:?w=40&h=30&density=0.35&seed=8")
+	if a.Grid().Checksum() == c.Grid().Checksum() {
+		t.Errorf("different seeds made the same grid")
+	}
+	for density, want := range map[string]int{"0": 0, "1": 40 * 30} {
+		s, err := ParseSoup("random:?w=40&h=30&density=" + density)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := gridPopulation(s.Grid()); got != want {
+			t.Errorf("density %s: got %d live cells, want %d", density, got, want)
+		}
+	}
+}
+
+func TestSoupSymmetry(t *testing.T) {
+	// Transforms (see TransformGrid) each symmetry is invariant under.
+	invariant := map[string][]int{
+		C2Symmetry: {2},
+		C4Symmetry: {1, 2, 3},
+		D8Symmetry: {1, 2, 3, 4, 5, 6, 7},
+	}
+	for symmetry, transforms := range invariant {
+		s, err := ParseSoup("random:?w=24&h=24&seed=3&symmetry=" + symmetry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		grid := s.Grid()
+		for _, tr := range transforms {
+			if TransformGrid(grid, tr).Checksum() != grid.Checksum() {
+				t.Errorf("%s soup changed by transform %d", symmetry, tr)
+			}
+		}
+	}
+}
+
+func TestParseSoupErrors(t *testing.T) {
+	for _, url := range []string{
+		"random:?w=0",
+		"random:?w=5000",
+		"random:?density=1.5",
+		"random:?seed=x",
+		"random:?symmetry=C3",
+		"random:?w=20&h=10&symmetry=C4",
+		"random:?size=20",
+	} {
+		if _, err := ParseSoup(url); err == nil {
+			t.Errorf("%s: no error", url)
+		}
+	}
+}
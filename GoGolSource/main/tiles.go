@@ -0,0 +1,155 @@
+package main
+
+import "sync"
+
+// Sparse (tiles) kernel.
+// The board is split into square tiles. A cell can only change if a cell
+// in its neighborhood changed in the last cycle, so only tiles where a
+// cell changed, and their neighbors, are recomputed; the rest are copied
+// forward. The first cycle, and any after the run's grid is replaced (ex.
+// by an edit) or its tile size changes, recompute every tile. Cycles
+// report the tiles recomputed.
+
+// Name of the tiles kernel.
+const TilesKernelName = "tiles"
+
+// Default tile width and height in cells. Tiles must be at least 2 cells
+// so a cell's neighbors are in its own or adjacent tiles.
+const DefaultTileSize = 32
+
+// Tiles changed by a run's last cycle.
+type tileState struct {
+	grid           *Grid  // the run's grid after the cycle
+	size           int    // of tiles
+	tilesX, tilesY int    // tiles across and down
+	dirty          []bool // by tile, in row order
+}
+
+// Get the tiles across and down a grid.
+func tileCounts(w, h, size int) (tilesX, tilesY int) {
+	return (w + size - 1) / size, (h + size - 1) / size
+}
+
+// Get the run's tile size.
+func (gr *GameRun) tileSize() int {
+	if gr.TileSize < 2 {
+		return DefaultTileSize
+	}
+	return gr.TileSize
+}
+
+// Choose the tiles a cycle recomputes.
+func (gr *GameRun) prepareTiles(gc *GameCycle) {
+	w, h := gc.BeforeGrid.Width, gc.BeforeGrid.Height
+	tilesX, tilesY := tileCounts(w, h, gc.TileSize)
+	gc.active = make([]bool, tilesX*tilesY)
+	gc.changed = make([]bool, h*tilesX)
+	ts := gr.tiles
+	if ts == nil || ts.grid != gr.CurrentGrid || ts.size != gc.TileSize ||
+		ts.tilesX != tilesX || ts.tilesY != tilesY {
+		for i := range gc.active {
+			gc.active[i] = true
+		}
+		gc.ActiveTiles = len(gc.active)
+		return
+	}
+	torus := gr.Topology == TorusTopology
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			if !ts.dirty[ty*tilesX+tx] {
+				continue
+			}
+			for ny := ty - 1; ny <= ty+1; ny++ {
+				for nx := tx - 1; nx <= tx+1; nx++ {
+					wx, wy := nx, ny
+					if torus {
+						wx, wy = (nx+tilesX)%tilesX, (ny+tilesY)%tilesY
+					} else if nx < 0 || nx >= tilesX || ny < 0 || ny >= tilesY {
+						continue
+					}
+					gc.active[wy*tilesX+wx] = true
+				}
+			}
+		}
+	}
+	gc.ActiveTiles = 0
+	for _, a := range gc.active {
+		if a {
+			gc.ActiveTiles++
+		}
+	}
+}
+
+// Record the tiles a cycle changed (after the run's grid is updated).
+func (gr *GameRun) finishTiles(gc *GameCycle) {
+	w, h := gc.AfterGrid.Width, gc.AfterGrid.Height
+	ts := &tileState{grid: gr.CurrentGrid, size: gc.TileSize}
+	ts.tilesX, ts.tilesY = tileCounts(w, h, ts.size)
+	ts.dirty = make([]bool, ts.tilesX*ts.tilesY)
+	for y := 0; y < h; y++ {
+		for tx := 0; tx < ts.tilesX; tx++ {
+			if gc.changed[y*ts.tilesX+tx] {
+				ts.dirty[(y/ts.size)*ts.tilesX+tx] = true
+			}
+		}
+	}
+	gr.tiles = ts
+	gc.active, gc.changed = nil, nil
+}
+
+// Play game as subset of grid rows (so can be done in parallel),
+// recomputing only active tiles.
+func processTiles(wg *sync.WaitGroup, gc *GameCycle, rowCount int,
+	startRow int, inGrid, outGrid *Grid) {
+	defer wg.Done()
+	rule := gc.Parent.Rule
+	torus := gc.Parent.Topology == TorusTopology
+	w, h := inGrid.Width, inGrid.Height
+	size := gc.TileSize
+	tilesX, _ := tileCounts(w, h, size)
+	endRow := startRow + rowCount
+	if endRow > h {
+		endRow = h
+	}
+	for y := startRow; y < endRow; y++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, x1 := tx*size, (tx+1)*size
+			if x1 > w {
+				x1 = w
+			}
+			if !gc.active[(y/size)*tilesX+tx] {
+				copy(outGrid.Data[y*w+x0:y*w+x1], inGrid.Data[y*w+x0:y*w+x1])
+				continue
+			}
+			changed := false
+			for x := x0; x < x1; x++ {
+				neighbors := 0
+				for ny := y - 1; ny <= y+1; ny++ {
+					wy := ny
+					if torus {
+						wy = (ny + h) % h
+					} else if ny < 0 || ny >= h {
+						continue
+					}
+					row := inGrid.Data[wy*w : wy*w+w]
+					for nx := x - 1; nx <= x+1; nx++ {
+						wx := nx
+						if torus {
+							wx = (nx + w) % w
+						} else if nx < 0 || nx >= w {
+							continue
+						}
+						if nx != x || ny != y {
+							neighbors += int(row[wx])
+						}
+					}
+				}
+				cell := inGrid.Data[y*w+x]
+				next := rule.Next(cell, neighbors)
+				outGrid.Data[y*w+x] = next
+				changed = changed || next != cell
+			}
+			gc.changed[y*tilesX+tx] = changed
+		}
+	}
+}
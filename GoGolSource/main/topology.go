@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Grid topologies: what lies beyond a grid's edges.
+const (
+	BoundedTopology   = "bounded"   // dead cells
+	TorusTopology     = "torus"     // the opposite edge
+	UnboundedTopology = "unbounded" // more grid, added as live cells near the edge
+)
+
+// Default topology.
+const DefaultTopology = BoundedTopology
+
+// Known topologies.
+var Topologies = []string{BoundedTopology, TorusTopology, UnboundedTopology}
+
+var BadTopologyError = errors.New("unknown topology")
+
+// Get a topology by name; empty is the default.
+func ParseTopology(name string) (topology string, err error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return DefaultTopology, nil
+	}
+	for _, t := range Topologies {
+		if name == t {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q; known: %v", BadTopologyError, name, Topologies)
+}
+
+// Get a cell, wrapping around the edges.
+func (g *Grid) getTorusCell(x, y int) byte {
+	x, y = (x%g.Width+g.Width)%g.Width, (y%g.Height+g.Height)%g.Height
+	return g.Data[x+y*g.Width]
+}
+
+// Unbounded grids.
+// An unbounded grid starts as the seed and grows by a chunk of cells on
+// each side with live cells near it, before the cycle that could reach
+// past the edge. A grid's X and Y are the world coordinates of its top
+// left cell; they go negative as it grows up or left. Grids stop growing
+// at MaxUnboundedCells; past that, cells beyond the edges are dead.
+
+// Cells added to a side of an unbounded grid when it grows.
+const growChunk = 64
+
+// Live cells this close to an edge make an unbounded grid grow; births can
+// then only be on the grid.
+const growMargin = 2
+
+// Most cells an unbounded grid grows to.
+const MaxUnboundedCells = 1 << 26
+
+// Get a grid grown so no live cell is near an edge; the grid itself if it
+// need not (or cannot) grow.
+func (g *Grid) grown() (out *Grid) {
+	w, h := g.Width, g.Height
+	m := growMargin
+	if w < 2*m || h < 2*m {
+		m = 0 // tiny grids always grow
+	}
+	live := func(data []byte) bool {
+		for _, b := range data {
+			if b != 0 {
+				return true
+			}
+		}
+		return false
+	}
+	top, bottom := live(g.Data[:m*w]), live(g.Data[(h-m)*w:])
+	left, right := m == 0, m == 0
+	for y := 0; y < h && !(left && right); y++ {
+		row := g.Data[y*w : y*w+w]
+		left = left || live(row[:m])
+		right = right || live(row[w-m:])
+	}
+	top, bottom = top || m == 0, bottom || m == 0
+	if !(top || bottom || left || right) {
+		return g
+	}
+	dx, dy := 0, 0
+	nw, nh := w, h
+	if left {
+		dx, nw = growChunk, nw+growChunk
+	}
+	if right {
+		nw += growChunk
+	}
+	if top {
+		dy, nh = growChunk, nh+growChunk
+	}
+	if bottom {
+		nh += growChunk
+	}
+	if nw*nh > MaxUnboundedCells {
+		return g
+	}
+	out = NewEmptyGrid(nw, nh)
+	out.X, out.Y = g.X-dx, g.Y-dy
+	for y := 0; y < h; y++ {
+		copy(out.Data[(y+dy)*nw+dx:], g.Data[y*w:y*w+w])
+	}
+	return
+}
+
+// Get a cell by world coordinates; cells off the grid are dead.
+func (g *Grid) getWorldCell(x, y int) byte {
+	return g.getCell(x-g.X, y-g.Y)
+}
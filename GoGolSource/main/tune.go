@@ -0,0 +1,178 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Goroutine auto-tuning.
+// An auto-tuned run picks its goroutine count (and, for the tiles kernel,
+// tile size) by throughput: it plays its first cycles with each candidate
+// in turn and keeps the fastest. Calibration cycles are ordinary cycles
+// (results do not depend on the choice), so no work is lost. Choices are
+// cached by board size, rule and kernel so later runs of the same kind
+// skip calibration. The choice and its measurements are reported in the
+// run's tuning.
+
+// Goroutines value (in forms) asking for auto-tuning.
+const AutoGoroutines = "auto"
+
+// Tuning sources.
+const (
+	calibratedTuning = "calibrated"
+	cachedTuning     = "cached"
+)
+
+// Tile sizes tried for the tiles kernel.
+var tuneTileSizes = []int{16, 32, 64, 128}
+
+// A run's auto-tuning decision.
+type XTuning struct {
+	Goroutines int       `json:"goroutines" xml:"Goroutines"`
+	TileSize   int       `json:"tileSize,omitempty" xml:"TileSize,omitempty"` // tiles kernel
+	Source     string    `json:"source" xml:"Source"`                         // calibrated or cached
+	Cycles     int       `json:"calibrationCycles" xml:"CalibrationCycles"`
+	Trials     []*XTrial `json:"trials,omitempty" xml:"Trials>Trial,omitempty"`
+}
+
+// A measured calibration cycle.
+type XTrial struct {
+	Goroutines     int     `json:"goroutines" xml:"Goroutines"`
+	TileSize       int     `json:"tileSize,omitempty" xml:"TileSize,omitempty"`
+	CellsPerSecond float64 `json:"cellsPerSecond" xml:"CellsPerSecond"`
+}
+
+// Kinds of run sharing a tuning profile.
+type tuneKey struct {
+	width, height int
+	rule, kernel  string
+}
+
+var (
+	tuneLock     sync.Mutex
+	tuneProfiles = make(map[tuneKey]*XTuning)
+)
+
+// Get the most goroutines an auto-tuned run may use.
+func autoGoroutineLimit() (n int) {
+	n = runtime.NumCPU()
+	if limit := CurrentLimits.MaxGoroutines; n > limit {
+		n = limit
+	}
+	return
+}
+
+// Get the goroutine counts to try: powers of 2 below a limit, and the limit.
+func tuneGoroutineCounts(limit int) (counts []int) {
+	for n := 1; n < limit; n *= 2 {
+		counts = append(counts, n)
+	}
+	return append(counts, limit)
+}
+
+// Pick the run's goroutine count and tile size from the cached profile,
+// else by playing calibration cycles; returns the cycles played.
+func (gr *GameRun) tune() (played int, err error) {
+	key := tuneKey{gr.Width, gr.Height, gr.Rule.Name, gr.Kernel}
+	tuneLock.Lock()
+	cached := tuneProfiles[key]
+	tuneLock.Unlock()
+	if cached != nil {
+		gr.setTuning(cached.Goroutines, cached.TileSize, &XTuning{Goroutines: cached.Goroutines,
+			TileSize: cached.TileSize, Source: cachedTuning})
+		return
+	}
+	limit := gr.GoroutineCount
+	if gr.granted > 0 && gr.granted < limit {
+		limit = gr.granted
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	t := &XTuning{Source: calibratedTuning}
+	cells := float64(gr.Width * gr.Height)
+	playCycle := func() (gc *GameCycle, ok bool) {
+		if played >= gr.MaxCycles {
+			return
+		}
+		if err = gr.NextCycle(); err != nil {
+			return
+		}
+		played++
+		return gr.Cycles[len(gr.Cycles)-1], true
+	}
+	measure := func(goroutines, tileSize int) (ok bool) {
+		warm := played == 0 || tileSize != gr.TileSize
+		gr.setTuning(goroutines, tileSize, nil)
+		if warm { // recomputes every tile
+			if _, ok = playCycle(); !ok {
+				return
+			}
+		}
+		gc, ok := playCycle()
+		if !ok {
+			return
+		}
+		seconds := gc.EndedAt.Sub(gc.StartedAt).Seconds()
+		if seconds <= 0 {
+			seconds = 1e-9
+		}
+		xt := &XTrial{Goroutines: gc.Goroutines, CellsPerSecond: cells / seconds}
+		if gr.Kernel == TilesKernelName {
+			xt.TileSize = gc.TileSize
+		}
+		t.Trials = append(t.Trials, xt)
+		return
+	}
+	best := func() (b *XTrial) {
+		for _, xt := range t.Trials {
+			if b == nil || xt.CellsPerSecond > b.CellsPerSecond {
+				b = xt
+			}
+		}
+		return
+	}
+	complete := true
+	for _, n := range tuneGoroutineCounts(limit) {
+		if complete = measure(n, gr.TileSize); !complete {
+			break
+		}
+	}
+	if complete && gr.Kernel == TilesKernelName {
+		n, current := best().Goroutines, gr.tileSize()
+		for _, size := range tuneTileSizes {
+			if size == current {
+				continue // measured
+			}
+			if complete = measure(n, size); !complete {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return
+	}
+	t.Cycles = played
+	if b := best(); b != nil {
+		t.Goroutines, t.TileSize = b.Goroutines, b.TileSize
+	} else {
+		t.Goroutines = limit
+	}
+	gr.setTuning(t.Goroutines, t.TileSize, t)
+	if complete {
+		tuneLock.Lock()
+		tuneProfiles[key] = t
+		tuneLock.Unlock()
+	}
+	return
+}
+
+// Set the run's goroutine count, tile size and (unless nil) tuning.
+func (gr *GameRun) setTuning(goroutines, tileSize int, t *XTuning) {
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	gr.GoroutineCount, gr.TileSize = goroutines, tileSize
+	if t != nil {
+		gr.Tuning = t
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Web UI.
+// A single page (HTML, script and style sheet) embedded from the ui
+// directory and served under /ui/; / redirects to it. The page uses only
+// the HTTP API (/history, /runs, /patterns).
+
+//go:embed ui
+var uiFiles embed.FS
+
+var uiServer = http.StripPrefix("/ui/", http.FileServer(http.FS(mustSub(uiFiles, "ui"))))
+
+// Get a subdirectory of an embedded file system.
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err) // embedded; cannot fail
+	}
+	return sub
+}
+
+// UI request handler.
+//
+//	GET /       redirect to /ui/
+//	GET /ui/... get a UI file
+func uiHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" && !strings.HasPrefix(request.URL.Path, "/ui/") {
+		sendError(writer, 404, "unknown resource %s", request.URL.Path)
+		return
+	}
+	if request.Method != "GET" && request.Method != "HEAD" {
+		writer.Header().Set("Allow", "GET, HEAD")
+		sendError(writer, 405, "method %s not allowed", request.Method)
+		return
+	}
+	if request.URL.Path == "/" {
+		http.Redirect(writer, request, "/ui/", http.StatusFound)
+		return
+	}
+	uiServer.ServeHTTP(writer, request)
+}
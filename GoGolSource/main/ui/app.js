@@ -0,0 +1,417 @@
+// Game of Life web UI; uses only the HTTP API.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+const state = {
+  run: null,      // selected run (as returned by the API)
+  frames: [],     // decoded grids by cycle, loaded as needed
+  populations: [],
+  cycle: 0,
+  timer: null,
+};
+
+// Show a status or error message.
+function status(message, isError) {
+  const s = $("status");
+  s.textContent = message || "";
+  s.className = isError ? "error" : "";
+}
+
+// Call the API; rejects with the server's error message.
+async function api(path, options) {
+  const response = await fetch(path, options);
+  if (!response.ok) {
+    let message = response.status + " " + response.statusText;
+    try {
+      const xe = await response.json();
+      if (xe.message) {
+        message = xe.message;
+      }
+    } catch (e) {
+      // not a structured error
+    }
+    throw new Error(message);
+  }
+  return response;
+}
+
+// Decode RLE into {width, height, cells (Uint8Array, row order)}.
+function parseRLE(text) {
+  let width = 0, height = 0;
+  const body = [];
+  for (const line of text.split("\n")) {
+    const t = line.trim();
+    if (t.startsWith("#") || t.length === 0) {
+      continue;
+    }
+    const header = t.match(/^x\s*=\s*(\d+)\s*,\s*y\s*=\s*(\d+)/);
+    if (header) {
+      width = +header[1];
+      height = +header[2];
+      continue;
+    }
+    body.push(t);
+  }
+  const cells = new Uint8Array(width * height);
+  let x = 0, y = 0, count = "";
+  for (const c of body.join("")) {
+    if (c >= "0" && c <= "9") {
+      count += c;
+      continue;
+    }
+    const n = count.length > 0 ? +count : 1;
+    count = "";
+    if (c === "!") {
+      break;
+    } else if (c === "$") {
+      y += n;
+      x = 0;
+    } else if (c === "b" || c === ".") {
+      x += n;
+    } else {
+      for (let i = 0; i < n && x < width; i++, x++) {
+        if (y < height) {
+          cells[y * width + x] = 1;
+        }
+      }
+    }
+  }
+  return {width, height, cells};
+}
+
+// Runs list.
+
+async function loadRuns() {
+  try {
+    const history = await (await api("/history")).json();
+    const runs = Object.values(history.Runs || {}).sort((a, b) => a.name.localeCompare(b.name));
+    const tbody = $("runs").querySelector("tbody");
+    tbody.textContent = "";
+    for (const run of runs) {
+      const tr = document.createElement("tr");
+      if (state.run && state.run.name === run.name) {
+        tr.className = "selected";
+      }
+      const cells = [run.name, run.imageURL, run.width + "x" + run.height,
+        String(run.gameCycles.length), run.rule];
+      cells.forEach((text, i) => {
+        const td = document.createElement("td");
+        td.textContent = text;
+        td.title = text;
+        if (i === 1) {
+          td.className = "source";
+        }
+        tr.appendChild(td);
+      });
+      const td = document.createElement("td");
+      const del = document.createElement("button");
+      del.type = "button";
+      del.textContent = "Delete";
+      del.addEventListener("click", (e) => {
+        e.stopPropagation();
+        deleteRun(run.name);
+      });
+      td.appendChild(del);
+      tr.appendChild(td);
+      tr.addEventListener("click", () => selectRun(run.name));
+      tbody.appendChild(tr);
+    }
+    $("noRuns").hidden = runs.length > 0;
+  } catch (e) {
+    status("Cannot load runs: " + e.message, true);
+  }
+}
+
+async function deleteRun(name) {
+  if (!confirm("Delete run " + name + "?")) {
+    return;
+  }
+  try {
+    await api("/runs/" + encodeURIComponent(name), {method: "DELETE"});
+    if (state.run && state.run.name === name) {
+      stop();
+      state.run = null;
+      $("viewer").hidden = true;
+    }
+    status("Deleted " + name);
+    loadRuns();
+  } catch (e) {
+    status("Cannot delete " + name + ": " + e.message, true);
+  }
+}
+
+// New run form.
+
+async function loadPatterns() {
+  try {
+    const list = await (await api("/patterns")).json();
+    const select = document.querySelector("select[name=pattern]");
+    for (const p of list.patterns) {
+      const option = document.createElement("option");
+      option.value = p.name;
+      option.textContent = p.title + " (" + p.category + ")";
+      option.dataset.info = p.width + "x" + p.height + ": " + p.description;
+      select.appendChild(option);
+    }
+    showPatternInfo();
+  } catch (e) {
+    status("Cannot load patterns: " + e.message, true);
+  }
+}
+
+function showPatternInfo() {
+  const option = document.querySelector("select[name=pattern]").selectedOptions[0];
+  $("patternInfo").textContent = option ? option.dataset.info : "";
+}
+
+function showSeedKind() {
+  const kind = document.querySelector("input[name=kind]:checked").value;
+  for (const div of document.querySelectorAll("[data-kind]")) {
+    div.hidden = div.dataset.kind !== kind;
+  }
+}
+
+// Make a seed URL from form fields; empty fields are left to the server.
+function seedURL(prefix, form, fields) {
+  const query = new URLSearchParams();
+  for (const [param, field] of fields) {
+    const v = form.elements[field].value.trim();
+    if (v.length > 0) {
+      query.set(param, v);
+    }
+  }
+  const q = query.toString();
+  return q.length > 0 ? prefix + "?" + q : prefix;
+}
+
+async function startRun(event) {
+  event.preventDefault();
+  const form = event.target;
+  const kind = form.elements.kind.value;
+  const name = form.elements.name.value.trim();
+  const fields = {name};
+  for (const field of ["rule", "cycles", "goroutines", "topology", "delay"]) {
+    fields[field] = form.elements[field].value.trim();
+  }
+  let options;
+  if (kind === "upload") {
+    const file = form.elements.file.files[0];
+    if (!file) {
+      status("Choose a file to upload", true);
+      return;
+    }
+    const body = new FormData();
+    for (const [k, v] of Object.entries(fields)) {
+      if (v.length > 0) {
+        body.append(k, v);
+      }
+    }
+    body.append("file", file);
+    options = {method: "POST", body};
+  } else {
+    let source = form.elements.url.value.trim();
+    if (kind === "pattern") {
+      source = seedURL("pattern:" + form.elements.pattern.value, form, [["w", "pw"], ["h", "ph"]]);
+    } else if (kind === "random") {
+      source = seedURL("random:", form, [["w", "rw"], ["h", "rh"], ["density", "density"],
+        ["seed", "seed"], ["symmetry", "symmetry"]]);
+    }
+    const rr = {name, source};
+    for (const [k, v] of Object.entries(fields)) {
+      if (k !== "name" && v.length > 0) {
+        if (k === "goroutines" && v === "auto") {
+          rr.autoTune = true;
+        } else {
+          rr[k] = ["cycles", "goroutines", "delay"].includes(k) ? +v : v;
+        }
+      }
+    }
+    options = {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(rr)};
+  }
+  status("Starting " + name + "...");
+  try {
+    await api("/runs", options);
+    status("Started " + name);
+    await loadRuns();
+    selectRun(name);
+  } catch (e) {
+    status("Cannot start " + name + ": " + e.message, true);
+  }
+}
+
+// Viewer.
+
+async function selectRun(name) {
+  stop();
+  try {
+    const run = await (await api("/runs/" + encodeURIComponent(name))).json();
+    state.run = run;
+    state.frames = [];
+    state.populations = [null].concat(run.gameCycles.map((c) => c.population));
+    $("viewer").hidden = false;
+    $("runTitle").textContent = run.name + " (" + run.imageURL + ")";
+    $("cycle").max = run.gameCycles.length;
+    for (const tr of $("runs").querySelectorAll("tbody tr")) {
+      tr.classList.toggle("selected", tr.firstChild.textContent === name);
+    }
+    await show(0);
+  } catch (e) {
+    status("Cannot load " + name + ": " + e.message, true);
+  }
+}
+
+async function frame(cycle) {
+  if (!state.frames[cycle]) {
+    const path = "/runs/" + encodeURIComponent(state.run.name) + "/cycles/" + cycle + "?format=rle";
+    state.frames[cycle] = parseRLE(await (await api(path)).text());
+    if (cycle === 0) {
+      state.populations[0] = state.frames[0].cells.reduce((n, c) => n + c, 0);
+    }
+  }
+  return state.frames[cycle];
+}
+
+async function show(cycle) {
+  const run = state.run;
+  if (!run) {
+    return;
+  }
+  cycle = Math.max(0, Math.min(cycle, run.gameCycles.length));
+  let grid;
+  try {
+    grid = await frame(cycle);
+  } catch (e) {
+    stop();
+    status("Cannot load cycle " + cycle + ": " + e.message, true);
+    return;
+  }
+  if (run !== state.run) {
+    return; // another run was selected meanwhile
+  }
+  state.cycle = cycle;
+  drawBoard(grid);
+  drawChart();
+  $("cycle").value = cycle;
+  $("cycleInfo").textContent = "Cycle " + cycle + " of " + run.gameCycles.length +
+    ", population " + state.populations[cycle] + ", rule " + run.rule + ", " + run.topology;
+}
+
+function drawBoard(grid) {
+  const zoom = +$("zoom").value;
+  const canvas = $("canvas");
+  canvas.width = grid.width * zoom;
+  canvas.height = grid.height * zoom;
+  const ctx = canvas.getContext("2d");
+  ctx.fillStyle = "#fff";
+  ctx.fillRect(0, 0, canvas.width, canvas.height);
+  ctx.fillStyle = "#000";
+  for (let y = 0; y < grid.height; y++) {
+    for (let x = 0; x < grid.width; x++) {
+      if (grid.cells[y * grid.width + x]) {
+        ctx.fillRect(x * zoom, y * zoom, zoom, zoom);
+      }
+    }
+  }
+}
+
+function drawChart() {
+  const canvas = $("chart");
+  const ctx = canvas.getContext("2d");
+  const pops = state.populations;
+  const w = canvas.width, h = canvas.height, pad = 20;
+  ctx.clearRect(0, 0, w, h);
+  const max = Math.max(1, ...pops.filter((p) => p !== null));
+  const xOf = (i) => pad + (w - 2 * pad) * (pops.length > 1 ? i / (pops.length - 1) : 0);
+  const yOf = (p) => h - pad - (h - 2 * pad) * p / max;
+  ctx.strokeStyle = "#999";
+  ctx.strokeRect(pad, pad, w - 2 * pad, h - 2 * pad);
+  ctx.fillStyle = "#666";
+  ctx.font = "11px sans-serif";
+  ctx.fillText(String(max), 2, pad - 6);
+  ctx.fillText("0", 2, h - pad);
+  ctx.strokeStyle = "#2a4d69";
+  ctx.beginPath();
+  let started = false;
+  pops.forEach((p, i) => {
+    if (p === null) {
+      return;
+    }
+    if (started) {
+      ctx.lineTo(xOf(i), yOf(p));
+    } else {
+      ctx.moveTo(xOf(i), yOf(p));
+      started = true;
+    }
+  });
+  ctx.stroke();
+  ctx.strokeStyle = "#d02020";
+  ctx.beginPath();
+  ctx.moveTo(xOf(state.cycle), pad);
+  ctx.lineTo(xOf(state.cycle), h - pad);
+  ctx.stroke();
+}
+
+function play() {
+  if (!state.run) {
+    return;
+  }
+  if (state.cycle >= state.run.gameCycles.length) {
+    state.cycle = -1; // restart from the beginning
+  }
+  $("play").textContent = "Pause";
+  const tick = async () => {
+    if (state.cycle >= state.run.gameCycles.length) {
+      stop();
+      return;
+    }
+    await show(state.cycle + 1);
+    if (state.timer !== null) {
+      state.timer = setTimeout(tick, +$("speed").value);
+    }
+  };
+  state.timer = setTimeout(tick, 0);
+}
+
+function stop() {
+  if (state.timer !== null) {
+    clearTimeout(state.timer);
+    state.timer = null;
+  }
+  $("play").textContent = "Play";
+}
+
+function init() {
+  $("refresh").addEventListener("click", loadRuns);
+  $("newRun").addEventListener("submit", startRun);
+  for (const radio of document.querySelectorAll("input[name=kind]")) {
+    radio.addEventListener("change", showSeedKind);
+  }
+  document.querySelector("select[name=pattern]").addEventListener("change", showPatternInfo);
+  $("play").addEventListener("click", () => (state.timer === null ? play() : stop()));
+  $("step").addEventListener("click", () => {
+    stop();
+    show(state.cycle + 1);
+  });
+  $("back").addEventListener("click", () => {
+    stop();
+    show(state.cycle - 1);
+  });
+  $("first").addEventListener("click", () => {
+    stop();
+    show(0);
+  });
+  $("last").addEventListener("click", () => {
+    stop();
+    show(state.run ? state.run.gameCycles.length : 0);
+  });
+  $("cycle").addEventListener("input", (e) => {
+    stop();
+    show(+e.target.value);
+  });
+  $("zoom").addEventListener("change", () => show(state.cycle));
+  loadRuns();
+  loadPatterns();
+}
+
+init();
@@ -1,43 +1,38 @@
 package main
 
 import (
-	"bytes"
 	"image"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"strings"
 )
 
 const NanosPerMs = 1_000_000
 const FilePrefix = "file:" // local (vs. HTTP) file
 
+// Load an image from a local file ("file:" prefix), the network or the
+// built-in pattern library ("pattern:" prefix).
+// Access is restricted by CurrentPolicy; image dimensions are checked
+// before the image is decoded.
 func LoadImage(url string) (img image.Image, kind string, err error) {
-	switch {
-	case strings.HasPrefix(url, FilePrefix):
-		url = url[len(FilePrefix):]
-		var b []byte
-		b, err = ioutil.ReadFile(url) // read image from file
-		if err != nil {
-			return
-		}
-		r := bytes.NewReader(b)
-		img, kind, err = image.Decode(r)
-		if err != nil {
-			return
-		}
-	default:
-		var resp *http.Response
-		resp, err = http.Get(url) // get image from network
-		if err != nil {
-			return
-		}
-		img, kind, err = image.Decode(resp.Body)
-		resp.Body.Close() // error ignored
-		if err != nil {
-			return
+	if strings.HasPrefix(url, PatternPrefix) {
+		var grid *Grid
+		if grid, err = LoadPattern(url); err == nil {
+			img, kind = GridImage(grid), patternKind
 		}
+		return
+	}
+	b, err := loadBytes(url)
+	if err != nil {
+		return
 	}
+	img, kind, err = decodeImage(b)
+	return
+}
+
+// Read the content of a local file ("file:" prefix) or network resource
+// as allowed by CurrentPolicy.
+func loadBytes(url string) (b []byte, err error) {
+	b, err = CurrentPolicy.ReadAll(url)
 	return
 }
 
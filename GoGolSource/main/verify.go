@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verifying runs.
+// A saved run records a checksum of its seed and of every cycle's grid
+// (see Grid.Checksum). Replaying the run, with its own or another kernel
+// and goroutine count, must reproduce every checksum.
+
+// Error values.
+var NoChecksumsError = errors.New("no checksums recorded")
+
+// The result of verifying a saved run with a kernel and goroutine count.
+type XVerifyResult struct {
+	Run        string `json:"run" xml:"Run"`
+	Kernel     string `json:"kernel" xml:"Kernel"`
+	Goroutines int    `json:"goroutineCount" xml:"GoroutineCount"`
+	Cycles     int    `json:"cycles" xml:"Cycles"`                         // cycles checked
+	Divergence int    `json:"divergence" xml:"Divergence"`                 // first divergent cycle; -1 if none
+	Expected   string `json:"expected,omitempty" xml:"Expected,omitempty"` // checksum at the divergence
+	Actual     string `json:"actual,omitempty" xml:"Actual,omitempty"`
+}
+
+// Report if the replay reproduced every checksum.
+func (vr *XVerifyResult) OK() bool {
+	return vr.Divergence < 0
+}
+
+// Replay a saved run with a kernel and goroutine count (the recorded ones
+// if empty or 0) and compare the checksums.
+func VerifySavedRun(saved *XSavedRun, kernel string, goroutines int) (vr *XVerifyResult, err error) {
+	xr := *saved.Run
+	if len(xr.SeedSum) == 0 {
+		return nil, fmt.Errorf("%w: run %s", NoChecksumsError, xr.Name)
+	}
+	if len(kernel) > 0 {
+		xr.Kernel = kernel
+	}
+	if goroutines > 0 {
+		xr.Goroutines = goroutines
+	}
+	gr, err := replaySavedRun(&XSavedRun{Run: &xr, Seed: saved.Seed})
+	if err != nil {
+		return
+	}
+	vr = &XVerifyResult{Run: xr.Name, Kernel: gr.Kernel, Goroutines: gr.GoroutineCount,
+		Divergence: -1}
+	diverged := func(cycle int, expected, actual string) bool {
+		if expected == actual {
+			return false
+		}
+		vr.Divergence, vr.Expected, vr.Actual = cycle, expected, actual
+		return true
+	}
+	if diverged(0, xr.SeedSum, formatChecksum(gr.InitialGrid.Checksum())) {
+		return
+	}
+	for i, xc := range xr.Cycles {
+		actual := "missing"
+		if i < len(gr.Cycles) {
+			actual = formatChecksum(gr.Cycles[i].Checksum)
+		}
+		if diverged(i+1, xc.Checksum, actual) {
+			return
+		}
+		vr.Cycles++
+	}
+	if len(gr.Cycles) > len(xr.Cycles) {
+		diverged(len(xr.Cycles)+1, "missing", formatChecksum(gr.Cycles[len(xr.Cycles)].Checksum))
+	}
+	return
+}
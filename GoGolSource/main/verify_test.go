@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Goroutine counts the golden runs are replayed with; 3 and 7 split rows
+// unevenly.
+var goldenGoroutineCounts = []int{1, 2, 3, 7, 16}
+
+func TestGoldenRuns(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no golden runs: %v", err)
+	}
+	for _, path := range paths {
+		saved, err := readSavedRun(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		for _, kernel := range KernelNames() {
+			for _, n := range goldenGoroutineCounts {
+				vr, err := VerifySavedRun(saved, kernel, n)
+				switch {
+				case err != nil:
+					t.Errorf("%s %s/%d: %v", path, kernel, n, err)
+				case !vr.OK():
+					t.Errorf("%s %s/%d: cycle %d checksum %s, want %s", path, kernel, n,
+						vr.Divergence, vr.Actual, vr.Expected)
+				case vr.Cycles != len(saved.Run.Cycles):
+					t.Errorf("%s %s/%d: checked %d cycles, want %d", path, kernel, n,
+						vr.Cycles, len(saved.Run.Cycles))
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyReportsDivergence(t *testing.T) {
+	saved, err := readSavedRun(filepath.Join("testdata", "golden", "glider.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := *saved.Run
+	run.Cycles = append([]*XGameCycle(nil), run.Cycles...)
+	bad := *run.Cycles[4]
+	bad.Checksum = "0000000000000000"
+	run.Cycles[4] = &bad
+	vr, err := VerifySavedRun(&XSavedRun{Run: &run, Seed: saved.Seed}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vr.Divergence != 5 || vr.Expected != bad.Checksum || vr.Actual != saved.Run.Cycles[4].Checksum {
+		t.Errorf("got divergence at %d (%s, want %s); want 5", vr.Divergence, vr.Actual, vr.Expected)
+	}
+	run.SeedSum = ""
+	if _, err = VerifySavedRun(&XSavedRun{Run: &run, Seed: saved.Seed}, "", 0); err == nil {
+		t.Errorf("no error verifying a run without checksums")
+	}
+}
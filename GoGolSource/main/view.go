@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Viewports.
+// Images of a run show a window (in world coordinates, see topology.go)
+// onto its grids. A fixed viewport shows the same window in every frame;
+// unset fields default to the smallest one holding every frame's grid (at
+// most MaxViewSize across, centered). A bounds
+// viewport is centered on each frame's live cells and an object viewport
+// on an object: the one (in the first frame) nearest a cell, then in each
+// later frame the one nearest it in the frame before. Following
+// viewports are the size of the initial grid unless set.
+
+// Viewport modes.
+const (
+	FixedView  = "fixed"
+	BoundsView = "bounds"
+	ObjectView = "object"
+)
+
+// Largest viewport width or height.
+const MaxViewSize = 4096
+
+var BadViewError = errors.New("bad viewport")
+
+// A window onto a run's grids; nil X and Y and zero W and H are the
+// default.
+type Viewport struct {
+	Mode             string
+	X, Y             *int // only for fixed viewports
+	W, H             int
+	ObjectX, ObjectY int // a cell of (or near) the object to follow
+}
+
+// Get a viewport from query parameters (x, y, w, h, view and object=X,Y);
+// nil if none are set.
+func readViewport(form url.Values) (v *Viewport, err error) {
+	names := []string{"x", "y", "w", "h", "view", "object"}
+	set := false
+	for _, name := range names {
+		set = set || len(form.Get(name)) > 0
+	}
+	if !set {
+		return
+	}
+	v = &Viewport{Mode: strings.ToLower(form.Get("view"))}
+	if len(v.Mode) == 0 {
+		v.Mode = FixedView
+		if len(form.Get("object")) > 0 {
+			v.Mode = ObjectView
+		}
+	}
+	x, y := 0, 0
+	for _, p := range []struct {
+		name string
+		v    *int
+		set  **int
+	}{{"x", &x, &v.X}, {"y", &y, &v.Y}, {"w", &v.W, nil}, {"h", &v.H, nil}} {
+		if xv := form.Get(p.name); len(xv) > 0 {
+			if *p.v, err = strconv.Atoi(xv); err != nil {
+				return nil, fmt.Errorf("%w: bad %s: %v", BadViewError, p.name, err)
+			}
+			if p.set != nil {
+				*p.set = p.v
+			}
+		}
+	}
+	if object := form.Get("object"); len(object) > 0 {
+		if _, err = fmt.Sscanf(object, "%d,%d", &v.ObjectX, &v.ObjectY); err != nil {
+			return nil, fmt.Errorf("%w: object must be X,Y", BadViewError)
+		}
+	}
+	switch {
+	case v.Mode != FixedView && v.Mode != BoundsView && v.Mode != ObjectView:
+		err = fmt.Errorf("%w: view must be %s, %s or %s", BadViewError, FixedView, BoundsView, ObjectView)
+	case v.Mode == ObjectView && len(form.Get("object")) == 0:
+		err = fmt.Errorf("%w: an object view needs object=X,Y", BadViewError)
+	case v.W < 0 || v.W > MaxViewSize || v.H < 0 || v.H > MaxViewSize:
+		err = fmt.Errorf("%w: w and h must be 0 (the default) to %d", BadViewError, MaxViewSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Get the windows a viewport shows of a run's frames (grids in order).
+func (v *Viewport) windows(gr *GameRun, frames []*Grid) (windows []*Grid) {
+	if v == nil {
+		v = &Viewport{Mode: FixedView}
+	}
+	w, h := v.W, v.H
+	if v.Mode == FixedView {
+		ux, uy, uw, uh := gridUnion(frames)
+		if w == 0 {
+			w = minInt(uw, MaxViewSize)
+		}
+		if h == 0 {
+			h = minInt(uh, MaxViewSize)
+		}
+		x, y := ux+(uw-w)/2, uy+(uh-h)/2
+		if v.X != nil {
+			x = *v.X
+		}
+		if v.Y != nil {
+			y = *v.Y
+		}
+		for _, grid := range frames {
+			windows = append(windows, grid.window(x, y, w, h))
+		}
+		return
+	}
+	if w == 0 || h == 0 {
+		w, h = gr.InitialGrid.Width, gr.InitialGrid.Height
+	}
+	initial := gr.InitialGrid
+	cx, cy := initial.X+initial.Width/2, initial.Y+initial.Height/2
+	if v.Mode == ObjectView {
+		cx, cy = v.ObjectX, v.ObjectY
+	}
+	for _, grid := range frames {
+		var ok bool
+		var x, y int
+		switch v.Mode {
+		case BoundsView:
+			x, y, ok = liveCenter(grid)
+		case ObjectView:
+			x, y, ok = nearestObject(grid, cx, cy)
+		}
+		if ok {
+			cx, cy = x, y
+		}
+		windows = append(windows, grid.window(cx-w/2, cy-h/2, w, h))
+	}
+	return
+}
+
+// Get the smallest window holding every grid.
+func gridUnion(grids []*Grid) (x, y, w, h int) {
+	x0, y0, x1, y1 := grids[0].X, grids[0].Y, grids[0].X+grids[0].Width, grids[0].Y+grids[0].Height
+	for _, g := range grids[1:] {
+		x0, y0 = minInt(x0, g.X), minInt(y0, g.Y)
+		x1, y1 = maxInt(x1, g.X+g.Width), maxInt(y1, g.Y+g.Height)
+	}
+	return x0, y0, x1 - x0, y1 - y0
+}
+
+// Get a window of a grid (at world coordinates); cells off the grid are
+// dead.
+func (g *Grid) window(x, y, w, h int) (out *Grid) {
+	out = NewEmptyGrid(w, h)
+	out.X, out.Y = x, y
+	for row := 0; row < h; row++ {
+		gy := y + row - g.Y
+		if gy < 0 || gy >= g.Height {
+			continue
+		}
+		for col := 0; col < w; col++ {
+			out.Data[row*w+col] = g.getCell(x+col-g.X, gy)
+		}
+	}
+	return
+}
+
+// Get the center of a grid's live cells (in world coordinates).
+func liveCenter(g *Grid) (x, y int, ok bool) {
+	minX, minY, maxX, maxY := g.Width, g.Height, -1, -1
+	for row := 0; row < g.Height; row++ {
+		for col := 0; col < g.Width; col++ {
+			if g.Data[row*g.Width+col] != 0 {
+				minX, minY = minInt(minX, col), minInt(minY, row)
+				maxX, maxY = maxInt(maxX, col), maxInt(maxY, row)
+			}
+		}
+	}
+	if maxX < 0 {
+		return
+	}
+	return g.X + (minX+maxX)/2, g.Y + (minY+maxY)/2, true
+}
+
+// Get the center of the object nearest a cell (in world coordinates).
+func nearestObject(g *Grid, x, y int) (cx, cy int, ok bool) {
+	best := -1
+	for _, cells := range findObjects(g.DeepCloneGrid()) {
+		d := -1
+		sx, sy := 0, 0
+		for _, c := range cells {
+			dx, dy := c.x+g.X-x, c.y+g.Y-y
+			if dd := dx*dx + dy*dy; d < 0 || dd < d {
+				d = dd
+			}
+			sx, sy = sx+c.x, sy+c.y
+		}
+		if best < 0 || d < best {
+			best = d
+			cx, cy = g.X+sx/len(cells), g.Y+sy/len(cells)
+			ok = true
+		}
+	}
+	return
+}
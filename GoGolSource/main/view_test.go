@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFixedViewDefaults(t *testing.T) {
+	grid := NewEmptyGrid(5000, 10)
+	grid.X, grid.Y = -100, -5
+	for _, tc := range []struct {
+		query      string
+		x, y, w, h int
+	}{
+		{"w=20", -100 + (5000-20)/2, -5, 20, 10},
+		{"", -100 + (5000-MaxViewSize)/2, -5, MaxViewSize, 10},
+		{"x=3", 3, -5, MaxViewSize, 10},
+		{"x=3&y=4", 3, 4, MaxViewSize, 10},
+		{"x=3&y=4&w=20&h=6", 3, 4, 20, 6},
+	} {
+		form, _ := url.ParseQuery("view=fixed&" + tc.query)
+		v, err := readViewport(form)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		win := v.windows(nil, []*Grid{grid})[0]
+		if win.X != tc.x || win.Y != tc.y || win.Width != tc.w || win.Height != tc.h {
+			t.Errorf("%s: got %dx%d at %d,%d; want %dx%d at %d,%d", tc.query,
+				win.Width, win.Height, win.X, win.Y, tc.w, tc.h, tc.x, tc.y)
+		}
+	}
+}